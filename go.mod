@@ -6,6 +6,7 @@ require (
 	github.com/iancoleman/strcase v0.2.0
 	github.com/syntax-framework/chain v0.0.0-20220914154445-844871db09de
 	github.com/syntax-framework/shtml v0.0.0-20220914154647-277be3d22cef
+	golang.org/x/net v0.0.0-20220708220712-1185a9018129
 	gopkg.in/yaml.v2 v2.2.2
 )
 
@@ -16,5 +17,4 @@ require (
 	github.com/tdewolff/parse/v2 v2.6.3 // indirect
 	github.com/tdewolff/test v1.0.7 // indirect
 	golang.org/x/crypto v0.0.0-20220829220503-c86fa9a7ed90 // indirect
-	golang.org/x/net v0.0.0-20220708220712-1185a9018129 // indirect
 )
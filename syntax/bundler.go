@@ -4,27 +4,43 @@ import (
 	"bytes"
 	"github.com/syntax-framework/shtml/cmn"
 	"github.com/syntax-framework/shtml/sht"
+	"log"
+	"sort"
+	"strings"
+	"sync"
 )
 
 // Bundler responsible for grouping the assets used by the pages and, from that, defining the most optimized way to
 // group these resources in order to maximize performance.
 type Bundler struct {
+	mutex             sync.Mutex
 	dirty             bool                    // Indica que houve mudança na
 	assetByName       map[string]*cmn.Asset   // facilita busca
 	assetByPage       map[string][]*cmn.Asset // Lista original de assets por página
 	assetRequired     map[*cmn.Asset]bool     // facilita busca
-	bundleByPageBuild map[string][]*cmn.Asset // Lista processada de assets por página
+	bundleByPageBuild map[string][]*cmn.Asset // Lista processada de bundles por página, na ordem de carregamento
+	bundleByAsset     map[*cmn.Asset]*cmn.Asset
 }
 
+// bundlerRequiredPage key, in bundleByPageBuild, of the bundles of the required assets. Used by pages without assets
+const bundlerRequiredPage = ""
+
 func (b *Bundler) AddRequiredAsset(asset *cmn.Asset) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
 	if b.assetRequired == nil {
 		b.assetRequired = map[*cmn.Asset]bool{}
 	}
 	b.assetRequired[asset] = true
+	b.dirty = true
 }
 
 // SetPageAssets define os assets que podem ser consumidos por uma página
 func (b *Bundler) SetPageAssets(page string, assets []*cmn.Asset) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
 	if b.assetByPage == nil {
 		b.assetByPage = map[string][]*cmn.Asset{}
 	}
@@ -50,37 +66,35 @@ func (b *Bundler) SetPageAssets(page string, assets []*cmn.Asset) {
 	}
 }
 
-// GetAssets returns all assets that should be displayed on a page
+// invalidate the content of an asset has changed, the bundles are built again
+func (b *Bundler) invalidate() {
+	b.mutex.Lock()
+	b.dirty = true
+	b.mutex.Unlock()
+}
+
+// GetAssets returns the bundles that should be displayed on a page, in the loading order
 func (b *Bundler) GetAssets(page string, assetType cmn.AssetType) []*cmn.Asset {
-	if b.dirty {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.dirty || b.bundleByPageBuild == nil {
 		b.build()
 		b.dirty = false
 	}
 
-	var assets cmn.Assets
-	if bundle, exists := b.bundleByPageBuild[page]; exists {
-		for _, asset := range bundle {
-			if asset.Type == assetType {
-				assets = append(assets, asset)
-			}
-		}
+	bundles, exists := b.bundleByPageBuild[page]
+	if !exists {
+		bundles = b.bundleByPageBuild[bundlerRequiredPage]
 	}
 
-	// required assets
-	for asset, _ := range b.assetRequired {
-		if asset.Type == assetType {
-			assets = append(assets, asset)
+	var assets []*cmn.Asset
+	for _, bundle := range bundles {
+		if bundle.Type == assetType {
+			assets = append(assets, bundle)
 		}
 	}
-
-	dependencies, err := assets.Resolve()
-	if err != nil {
-		// @TODO: Ciclic dependencies, how to solve?
-		println(err)
-		return nil
-	}
-
-	return dependencies
+	return assets
 }
 
 // GetScripts returns all assets that should be displayed on a page
@@ -104,7 +118,7 @@ func (b *Bundler) GetScripts(page string) string {
 
 		if asset.Attributes != nil {
 			for name, value := range asset.Attributes {
-				buf.WriteString(name)
+				buf.WriteString(" " + name)
 				if value != "" {
 					buf.WriteString(`="` + sht.HtmlEscape(value) + `"`)
 				}
@@ -120,17 +134,13 @@ func (b *Bundler) GetScripts(page string) string {
 func (b *Bundler) GetStyles(page string) string {
 	buf := &bytes.Buffer{}
 	for _, asset := range b.GetAssets(page, cmn.Stylesheet) {
-		// @TODO: CACHE IN MEMORY
 		// @TODO: meta data
 		// media="all"
 		// crossorigin="anonymous"
 		buf.WriteString(`<link rel="stylesheet"`)
-
-		if asset.Url != "" {
-			buf.WriteString(` href="` + asset.Url + `"`)
-		} else {
-			buf.WriteString(` href="/assets/css/` + asset.Name + `.css"`)
-		}
+		buf.WriteString(` href="` + styleHref(asset) + `"`)
+		// allows the live reload to replace the stylesheet, see liveReloadAsset
+		buf.WriteString(` data-asset="` + sht.HtmlEscape(asset.Name) + `"`)
 
 		if asset.Integrity != "" {
 			buf.WriteString(` integrity="` + asset.Integrity + `"`)
@@ -150,8 +160,37 @@ func (b *Bundler) GetStyles(page string) string {
 	return buf.String()
 }
 
+// styleHref the url of the stylesheet. The fingerprint (Etag) changes when the content changes
+func styleHref(asset *cmn.Asset) string {
+	if asset.Url != "" {
+		return asset.Url
+	}
+	href := "/assets/css/" + asset.Name + ".css"
+	if asset.Etag != "" {
+		href += "?vsn=" + asset.Etag
+	}
+	return href
+}
+
+// bundlerGroup assets concatenated into a bundle
+type bundlerGroup struct {
+	assets     []*cmn.Asset
+	standalone bool // external or with attributes, can't be concatenated
+}
+
+// isBundleable checks if the asset can be concatenated with others. External assets and assets with attributes
+// (read by the script itself, ex. `data-endpoint`) are kept as they are.
+func isBundleable(asset *cmn.Asset) bool {
+	return asset.Url == "" && len(asset.Attributes) == 0 && len(asset.Content) > 0
+}
+
 // build faz o build do bundle, usa DAG para identificar recursos comuns e maximizar a performance de carregamento
 // de assets
+//
+// Assets used by the same set of pages are concatenated into the same bundle, named by the hash of its content.
+// The assets are processed in the order of cmn.Assets.Resolve, an asset that depends on an asset of a bundle created
+// after the current bundle of its set of pages starts a new bundle. That way, loading the bundles in the order in
+// which they were created respects the dependencies.
 func (b *Bundler) build() {
 	// https://devdocs.magento.com/guides/v2.4/performance-best-practices/advanced-js-bundling.html
 	// https://towardsdatascience.com/network-graphs-for-dependency-resolution-5327cffe650f
@@ -160,19 +199,179 @@ func (b *Bundler) build() {
 	// https://github.com/autom8ter/dagger
 	b.assetByName = map[string]*cmn.Asset{}
 	b.bundleByPageBuild = map[string][]*cmn.Asset{}
-	for page, assets := range b.assetByPage {
-		// @TODO: Implementar logica de build correta, por hora só está copiando os assets, é necessário computar dependencias
-		b.bundleByPageBuild[page] = assets
-		for _, asset := range assets {
-			b.assetByName[asset.Name] = asset
+	b.bundleByAsset = map[*cmn.Asset]*cmn.Asset{}
+
+	pages := []string{bundlerRequiredPage}
+	for page := range b.assetByPage {
+		if page != bundlerRequiredPage {
+			pages = append(pages, page)
+		}
+	}
+	sort.Strings(pages)
+
+	for _, assetType := range []cmn.AssetType{cmn.Javascript, cmn.Stylesheet} {
+		var required cmn.Assets
+		for asset := range b.assetRequired {
+			if asset.Type == assetType {
+				required = append(required, asset)
+			}
+		}
+		// the same assets always produce the same bundles
+		sort.Slice(required, func(i, j int) bool {
+			return required[i].Name < required[j].Name
+		})
+
+		// assets of each page (with dependencies) and the pages of each asset
+		var all cmn.Assets
+		pageAssets := map[string]map[*cmn.Asset]bool{}
+		assetPages := map[*cmn.Asset][]string{}
+		for _, page := range pages {
+			assets := append(cmn.Assets{}, required...)
+			for _, asset := range b.assetByPage[page] {
+				if asset.Type == assetType {
+					assets = append(assets, asset)
+				}
+			}
+
+			resolved, err := assets.Resolve()
+			if err != nil {
+				// @TODO: Ciclic dependencies, how to solve?
+				log.Printf("[syntax] unable to resolve the assets of the page %s. %s", page, err)
+				continue
+			}
+
+			pageAssets[page] = map[*cmn.Asset]bool{}
+			for _, asset := range resolved {
+				pageAssets[page][asset] = true
+				if assetPages[asset] == nil {
+					all = append(all, asset)
+				}
+				assetPages[asset] = append(assetPages[asset], page)
+			}
+		}
+
+		order, err := all.Resolve()
+		if err != nil {
+			log.Printf("[syntax] unable to resolve the assets. %s", err)
+			continue
 		}
+
+		var groups []*bundlerGroup
+		groupByAsset := map[*cmn.Asset]int{}
+		groupByPages := map[string]int{} // current group of the set of pages
+		for _, asset := range order {
+			if !isBundleable(asset) {
+				groups = append(groups, &bundlerGroup{assets: []*cmn.Asset{asset}, standalone: true})
+				groupByAsset[asset] = len(groups) - 1
+				continue
+			}
+
+			key := strings.Join(assetPages[asset], "\n")
+			index, exists := groupByPages[key]
+			for _, dependency := range asset.Dependencies {
+				if dependencyIndex, isGrouped := groupByAsset[dependency]; isGrouped && dependencyIndex > index {
+					exists = false
+				}
+			}
+			if !exists {
+				groups = append(groups, &bundlerGroup{})
+				index = len(groups) - 1
+				groupByPages[key] = index
+			}
+			groups[index].assets = append(groups[index].assets, asset)
+			groupByAsset[asset] = index
+		}
+
+		for _, group := range groups {
+			bundle := group.bundle(assetType)
+			b.assetByName[bundle.Name] = bundle
+			for _, asset := range group.assets {
+				b.bundleByAsset[asset] = bundle
+				b.assetByName[asset.Name] = asset
+			}
+
+			// all assets of the group are used by the same pages
+			for _, page := range assetPages[group.assets[0]] {
+				b.bundleByPageBuild[page] = append(b.bundleByPageBuild[page], bundle)
+			}
+		}
+
+		for _, page := range pages {
+			if _, exists := b.bundleByPageBuild[page]; !exists && pageAssets[page] != nil {
+				b.bundleByPageBuild[page] = []*cmn.Asset{}
+			}
+		}
+	}
+}
+
+// bundle concatenates the content of the assets of the group
+func (g *bundlerGroup) bundle(assetType cmn.AssetType) *cmn.Asset {
+	if g.standalone {
+		return g.assets[0]
 	}
 
-	for asset, _ := range b.assetRequired {
-		b.assetByName[asset.Name] = asset
+	separator := []byte("\n")
+	if assetType == cmn.Javascript {
+		// prevents the last statement of a file from joining the first statement of the next
+		separator = []byte("\n;\n")
+	}
+
+	var contents [][]byte
+	for _, asset := range g.assets {
+		contents = append(contents, asset.Content)
+	}
+	content := bytes.Join(contents, separator)
+
+	return &cmn.Asset{
+		Content:   content,
+		Name:      sht.HashXXH64(content),
+		Size:      int64(len(content)),
+		Type:      assetType,
+		Integrity: "sha512-" + sht.HashSha512Base64(content),
 	}
 }
 
 func (b *Bundler) GetAssetByName(name string) *cmn.Asset {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
 	return b.assetByName[name]
 }
+
+// getBundle the bundle that contains the asset
+func (b *Bundler) getBundle(asset *cmn.Asset) *cmn.Asset {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.dirty || b.bundleByPageBuild == nil {
+		b.build()
+		b.dirty = false
+	}
+	if bundle, exists := b.bundleByAsset[asset]; exists {
+		return bundle
+	}
+	return asset
+}
+
+// getAssetsByFilepath the assets loaded from the file (ex. `/assets/css/site.css`)
+func (b *Bundler) getAssetsByFilepath(filepath string) []*cmn.Asset {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	found := map[*cmn.Asset]bool{}
+	var assets []*cmn.Asset
+	check := func(asset *cmn.Asset) {
+		if asset.Filepath != "" && !found[asset] && pageGraphKey(asset.Filepath) == pageGraphKey(filepath) {
+			found[asset] = true
+			assets = append(assets, asset)
+		}
+	}
+	for _, pageAssets := range b.assetByPage {
+		for _, asset := range pageAssets {
+			check(asset)
+		}
+	}
+	for asset := range b.assetRequired {
+		check(asset)
+	}
+	return assets
+}
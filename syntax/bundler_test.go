@@ -0,0 +1,72 @@
+package syntax
+
+import (
+	"github.com/syntax-framework/shtml/cmn"
+	"github.com/syntax-framework/shtml/sht"
+	"strings"
+	"testing"
+)
+
+func Test_Bundler_Build(t *testing.T) {
+	newJs := func(name string, content string, dependencies ...*cmn.Asset) *cmn.Asset {
+		return &cmn.Asset{Name: name, Type: cmn.Javascript, Content: []byte(content), Dependencies: dependencies}
+	}
+
+	live := newJs("stx", "stx()")
+	live.Priority = 100
+	live.Attributes = map[string]string{"data-endpoint": "/live"}
+	shared := newJs("shared", "shared()")
+	lib := newJs("lib", "lib()")
+	pageA := newJs("a", "a()", shared, lib)
+	pageB := newJs("b", "b()")
+	style := &cmn.Asset{Name: "site", Type: cmn.Stylesheet, Content: []byte("b{}")}
+
+	bundler := &Bundler{}
+	bundler.AddRequiredAsset(live)
+	bundler.SetPageAssets("/a", []*cmn.Asset{pageA, shared, style})
+	bundler.SetPageAssets("/b", []*cmn.Asset{pageB, shared, style})
+
+	bundlesA := bundler.GetAssets("/a", cmn.Javascript)
+	bundlesB := bundler.GetAssets("/b", cmn.Javascript)
+	if len(bundlesA) != 3 || len(bundlesB) != 3 {
+		t.Fatalf("Bundler.GetAssets(page) | invalid number of bundles\n   actual: %d %d\n expected: 3 3", len(bundlesA), len(bundlesB))
+	}
+
+	// assets with attributes are not concatenated
+	if bundlesA[0] != live || bundlesB[0] != live {
+		t.Errorf("Bundler.GetAssets(page) | the asset with attributes must be kept")
+	}
+
+	// shared by the pages, loaded before the dependent bundle
+	sharedBundle := bundler.getBundle(shared)
+	if bundlesA[1] != sharedBundle || (bundlesB[1] != sharedBundle && bundlesB[2] != sharedBundle) {
+		t.Errorf("Bundler.GetAssets(page) | the shared bundle must be loaded before the bundles of the page")
+	}
+	if string(sharedBundle.Content) != "shared()" || sharedBundle.Name != sht.HashXXH64(sharedBundle.Content) {
+		t.Errorf("Bundler.build() | invalid shared bundle\n   actual: %s %s", sharedBundle.Name, sharedBundle.Content)
+	}
+
+	bundleA := bundler.getBundle(pageA)
+	if bundlesA[2] != bundleA || string(bundleA.Content) != "lib()\n;\na()" {
+		t.Errorf("Bundler.build() | invalid bundle of the page\n   actual: %s", bundleA.Content)
+	}
+	if bundler.GetAssetByName(bundleA.Name) != bundleA {
+		t.Errorf("Bundler.GetAssetByName(name) | the bundle must be served")
+	}
+
+	scripts := bundler.GetScripts("/a")
+	if strings.Count(scripts, "<script") != 3 || !strings.Contains(scripts, `src="/assets/js/`+bundleA.Name+`.js"`) {
+		t.Errorf("Bundler.GetScripts(page) | one tag per bundle expected\n   actual: %s", scripts)
+	}
+	if !strings.Contains(scripts, ` data-endpoint="/live"`) {
+		t.Errorf("Bundler.GetScripts(page) | invalid attributes\n   actual: %s", scripts)
+	}
+	if styles := bundler.GetStyles("/b"); strings.Count(styles, "<link") != 1 {
+		t.Errorf("Bundler.GetStyles(page) | one tag per bundle expected\n   actual: %s", styles)
+	}
+
+	// pages without assets, only the required
+	if bundles := bundler.GetAssets("/other", cmn.Javascript); len(bundles) != 1 || bundles[0] != live {
+		t.Errorf("Bundler.GetAssets(page) | only the required assets expected\n   actual: %v", bundles)
+	}
+}
@@ -1 +1,529 @@
 package syntax
+
+import (
+	"encoding/json"
+	"github.com/syntax-framework/shtml/cmn"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errorChannelExists = cmn.Err(
+	"pubsub.channel.exists",
+	"There is already a Channel registered with the same name.", "Name: %s",
+)
+
+var errorChannelOnExists = cmn.Err(
+	"pubsub.channel.on.exists",
+	"There is already an On callback for the same event.", "Channel: %s", "Event: %s",
+)
+
+var errorInvalidEventName = cmn.Err(
+	"pubsub.event.name",
+	"Not a valid Event name.", "Name: %s",
+)
+
+var errorTopicJoinRejected = cmn.Err(
+	"pubsub.topic.join.rejected",
+	"The request to join the topic was refused.", "Channel: %s", "Topic: %s", "Reason: %s",
+)
+
+var errorTopicNotJoined = cmn.Err(
+	"pubsub.topic.notjoined",
+	"The socket must join the topic before sending events.", "Channel: %s", "Topic: %s",
+)
+
+var errorChannelNotFound = cmn.Err(
+	"pubsub.channel.notfound",
+	"There is no Channel registered with the given name.", "Name: %s",
+)
+
+// Message is the content exchanged between the server and the clients joined to a topic
+type Message struct {
+	Channel string      `json:"channel"`
+	Topic   string      `json:"topic"`
+	Event   string      `json:"event,omitempty"`
+	Payload interface{} `json:"payload,omitempty"`
+	Ref     string      `json:"ref,omitempty"`
+}
+
+// socketConn the connection of a client with the live server
+type socketConn interface {
+	send(event *SSEEvent) bool // queues an event to be sent to the client
+	lastEventID() int          // the `Last-Event-ID` informed by the client when connecting
+}
+
+// Socket represents a user's connection to a specific Channel
+type Socket struct {
+	//Params  Params
+	ID      string
+	Channel *Channel
+	request *http.Request
+	conn    socketConn
+	mutex   sync.Mutex
+	topics  map[string]bool // topics joined by this socket
+}
+
+// Joined checks if the socket has joined the topic
+func (s *Socket) Joined(topic string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.topics[topic]
+}
+
+// Topics list of topics joined by this socket
+func (s *Socket) Topics() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var topics []string
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// setJoined records the socket membership in a topic, returns false if nothing has changed
+func (s *Socket) setJoined(topic string, joined bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.topics == nil {
+		s.topics = map[string]bool{}
+	}
+	if s.topics[topic] == joined {
+		return false
+	}
+	if joined {
+		s.topics[topic] = true
+	} else {
+		delete(s.topics, topic)
+	}
+	return true
+}
+
+// leaveAll removes the socket from all topics, used when the client connection drops
+func (s *Socket) leaveAll() {
+	for _, topic := range s.Topics() {
+		s.Channel.requestLeave(topic, s)
+	}
+}
+
+// Request the http request that originated the connection of this socket
+func (s *Socket) Request() *http.Request {
+	return s.request
+}
+
+// Push sends an event directly to the client of this socket
+func (s *Socket) Push(topic string, event string, payload interface{}) {
+	s.deliver(&Message{
+		Channel: s.Channel.name,
+		Topic:   topic,
+		Event:   event,
+		Payload: payload,
+	})
+}
+
+// deliver sends a message to the client
+func (s *Socket) deliver(message *Message) {
+	event, err := encodeMessage(message)
+	if err != nil {
+		log.Printf("[syntax] unable to serialize message to topic %s:%s. %s", message.Channel, message.Topic, err)
+		return
+	}
+	s.send(event)
+}
+
+func (s *Socket) send(event *SSEEvent) {
+	if s.conn != nil {
+		s.conn.send(event)
+	}
+}
+
+// encodeMessage creates the event that transports the message to the client
+func encodeMessage(message *Message) (*SSEEvent, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return &SSEEvent{
+		timestamp: time.Now(),
+		Event:     []byte(message.Channel + ":" + message.Topic),
+		Data:      data,
+	}, nil
+}
+
+// Channel handle events from clients. Channels are the highest level abstraction for real-time communication components
+// in Syntax.
+//
+// Channels provide a means for bidirectional communication from clients that integrate with the Syntax PubSub layer
+// for soft-realtime functionality.
+type Channel struct {
+	name      string
+	syntax    *Syntax
+	mutex     sync.RWMutex
+	onJoin    map[string]ChannelOnJoinFunc
+	onLeave   ChannelOnLeaveFunc
+	onMessage map[string]ChannelOnMessageFunc
+	topics    map[string]*channelTopic // topics with at least one joined socket
+	presence  *Presence
+}
+
+// channelTopic the sockets joined to a topic on this server
+type channelTopic struct {
+	name        string // full name, "channel:topic"
+	sockets     map[*Socket]bool
+	unsubscribe func()
+}
+
+// ChannelOnJoinFunc  Clients must join a channel to send and receive PubSub events on that channel.
+//
+// # Authorization
+//
+// Your channels must register a `OnJoin()` callback that authorizes the socket	for the given topic.
+// For example, you could check if the user is allowed to	join that particular room.
+//
+// To authorize a socket in [Channel.OnJoin()], return `nil`.
+//
+//	To refuse authorization in [Channel.OnJoin()], return `error`.
+type ChannelOnJoinFunc func(topic string, params map[string]interface{}, socket *Socket) error
+
+// ChannelOnLeaveFunc invoked when the socket leaves a topic, either by the client request or because its connection
+// has dropped
+type ChannelOnLeaveFunc func(topic string, socket *Socket)
+
+// JoinError refusal of a client's request to join a topic
+type JoinError struct {
+	Channel string
+	Topic   string
+	Reason  error // error returned by the OnJoin callback, nil if there is no callback for the topic
+}
+
+func (e *JoinError) Error() string {
+	reason := "there is no OnJoin callback for the topic"
+	if e.Reason != nil {
+		reason = e.Reason.Error()
+	}
+	return errorTopicJoinRejected(e.Channel, e.Topic, reason).Error()
+}
+
+func (e *JoinError) Unwrap() error {
+	return e.Reason
+}
+
+// ChannelOnMessageFunc handles an event sent by the client to a topic of the channel. The returned value is sent back
+// to the client as the reply of the event.
+type ChannelOnMessageFunc func(topic string, params map[string]interface{}, socket *Socket) (interface{}, error)
+
+// Name of this channel
+func (c *Channel) Name() string {
+	return c.name
+}
+
+// OnJoin invocado quando o client procura conectar-se a este tópico neste channel
+func (c *Channel) OnJoin(topic string, callback ChannelOnJoinFunc) error {
+	topic = strings.TrimPrefix(strings.TrimSpace(topic), ":")
+	if topic != "*" && (topic == "" || !isBase64(topic)) {
+		return errorInvalidTopicName(topic)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, exist := c.onJoin[topic]; exist {
+		return errorTopicOnJoinExists(c.name, topic)
+	}
+
+	c.onJoin[topic] = callback
+
+	return nil
+}
+
+// OnLeave registers the callback invoked when a socket leaves a topic of this channel
+func (c *Channel) OnLeave(callback ChannelOnLeaveFunc) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.onLeave = callback
+}
+
+// requestJoin authorizes the socket to join the topic. The OnJoin callback of the topic is used and, if it does not
+// exist, the wildcard `*` callback. The socket only becomes a member of the topic if the callback returns nil.
+func (c *Channel) requestJoin(topic string, params map[string]interface{}, socket *Socket) error {
+	if topic == "" || !isBase64(topic) {
+		return errorInvalidTopicName(topic)
+	}
+
+	c.mutex.RLock()
+	callback, exists := c.onJoin[topic]
+	if !exists {
+		callback, exists = c.onJoin["*"]
+	}
+	c.mutex.RUnlock()
+
+	if !exists {
+		return &JoinError{Channel: c.name, Topic: topic}
+	}
+
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	if err := callback(topic, params, socket); err != nil {
+		return &JoinError{Channel: c.name, Topic: topic, Reason: err}
+	}
+
+	if socket.setJoined(topic, true) {
+		if err := c.join(topic, socket); err != nil {
+			socket.setJoined(topic, false)
+			return err
+		}
+	}
+	return nil
+}
+
+// requestLeave removes the socket from the topic and invokes the OnLeave callback
+func (c *Channel) requestLeave(topic string, socket *Socket) {
+	if !socket.setJoined(topic, false) {
+		return
+	}
+	c.leave(topic, socket)
+
+	c.mutex.RLock()
+	callback := c.onLeave
+	presence := c.presence
+	c.mutex.RUnlock()
+
+	if presence != nil {
+		presence.Untrack(socket, topic)
+	}
+
+	if callback != nil {
+		callback(topic, socket)
+	}
+}
+
+// On registers the callback that handles an event sent by the clients to any topic of this channel
+func (c *Channel) On(event string, callback ChannelOnMessageFunc) error {
+	event = strings.TrimSpace(event)
+	if event == "" || !isBase64(event) {
+		return errorInvalidEventName(event)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, exist := c.onMessage[event]; exist {
+		return errorChannelOnExists(c.name, event)
+	}
+
+	c.onMessage[event] = callback
+
+	return nil
+}
+
+// handle executes the callback registered for the event
+func (c *Channel) handle(topic string, event string, params map[string]interface{}, socket *Socket) (interface{}, error) {
+	c.mutex.RLock()
+	callback, exists := c.onMessage[event]
+	c.mutex.RUnlock()
+
+	if !exists {
+		return nil, errorChannelEventNotFound(c.name, event)
+	}
+
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	return callback(topic, params, socket)
+}
+
+// join adds the socket to the topic, from then on the socket receives everything that is published on the topic
+func (c *Channel) join(topic string, socket *Socket) error {
+	c.mutex.Lock()
+	ct, exists := c.topics[topic]
+	if exists {
+		ct.sockets[socket] = true
+	}
+	c.mutex.Unlock()
+
+	if !exists {
+		if err := c.subscribe(topic, socket); err != nil {
+			return err
+		}
+	}
+
+	// reconnection, sends the events lost by the client
+	if socket.conn != nil {
+		if lastEventID := socket.conn.lastEventID(); lastEventID > 0 {
+			c.replay(topic, lastEventID, socket)
+		}
+	}
+	return nil
+}
+
+// subscribe creates the topic with the socket. The subscription in the PubSub is made without holding the lock of the
+// channel, when another socket creates the topic meanwhile, the socket is added to that topic.
+func (c *Channel) subscribe(topic string, socket *Socket) error {
+	name := c.name + ":" + topic
+	unsubscribe := func() {}
+	if !c.syntax.isTopicPersisted(name) {
+		// persistent topics are always subscribed, see Syntax.PersistTopic
+		var err error
+		unsubscribe, err = c.syntax.pubsub.Subscribe(name, func(content interface{}) {
+			if c.syntax.isTopicPersisted(name) {
+				// delivered by the subscription of the log, see Channel.persist
+				return
+			}
+			c.relay(topic, content)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	c.mutex.Lock()
+	ct, exists := c.topics[topic]
+	if !exists {
+		ct = &channelTopic{
+			name:        name,
+			sockets:     map[*Socket]bool{},
+			unsubscribe: unsubscribe,
+		}
+		c.topics[topic] = ct
+	}
+	ct.sockets[socket] = true
+	c.mutex.Unlock()
+
+	if exists {
+		unsubscribe()
+	}
+	return nil
+}
+
+// replay resends to the socket the events of the topic after the given id. If these events are no longer available
+// the client receives the "reset" event
+func (c *Channel) replay(topic string, lastEventID int, socket *Socket) {
+	var events []*SSEEvent
+	var ok bool
+	if topicLog := c.syntax.getTopicLog(c.name + ":" + topic); topicLog != nil {
+		var err error
+		if events, ok, err = topicLog.since(lastEventID); err != nil {
+			log.Printf("[syntax] unable to read the log of topic %s:%s. %s", c.name, topic, err)
+		}
+	} else {
+		events, ok = c.syntax.sseReplay.since(c.name+":"+topic, lastEventID)
+	}
+	if !ok {
+		socket.Push(topic, "reset", nil)
+		return
+	}
+	for _, event := range events {
+		socket.send(event)
+	}
+}
+
+// leave removes the socket from the topic, when the last socket leaves, the server stops listening to the topic
+func (c *Channel) leave(topic string, socket *Socket) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ct, exists := c.topics[topic]
+	if !exists {
+		return
+	}
+	delete(ct.sockets, socket)
+	if len(ct.sockets) == 0 {
+		delete(c.topics, topic)
+		ct.unsubscribe()
+	}
+}
+
+// persist cancels the subscription of the topic, the messages are delivered by the subscription of its log (see
+// Syntax.subscribeTopicLog)
+func (c *Channel) persist(topic string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if ct, exists := c.topics[topic]; exists {
+		ct.unsubscribe()
+		ct.unsubscribe = func() {}
+	}
+}
+
+// relay delivers the content published on a topic to all sockets joined to that topic
+func (c *Channel) relay(topic string, content interface{}) {
+	event, err := encodeTopicEvent(c.name, topic, content)
+	if err != nil {
+		log.Printf("[syntax] unable to serialize message to topic %s:%s. %s", c.name, topic, err)
+		return
+	}
+	c.syntax.sseReplay.record(c.name+":"+topic, event)
+	c.broadcast(topic, event)
+}
+
+// broadcast sends the event to all sockets joined to the topic
+func (c *Channel) broadcast(topic string, event *SSEEvent) {
+	c.mutex.RLock()
+	var sockets []*Socket
+	if ct, exists := c.topics[topic]; exists {
+		for socket := range ct.sockets {
+			sockets = append(sockets, socket)
+		}
+	}
+	c.mutex.RUnlock()
+
+	for _, socket := range sockets {
+		socket.send(event)
+	}
+}
+
+// encodeTopicEvent creates the event that transports the content published on a topic
+func encodeTopicEvent(channel string, topic string, content interface{}) (*SSEEvent, error) {
+	message := &Message{Payload: content}
+	if published, isMessage := content.(*Message); isMessage {
+		copied := *published
+		message = &copied
+	}
+	message.Channel = channel
+	message.Topic = topic
+	return encodeMessage(message)
+}
+
+// Channel registra um novo channel para comunicação em tempo real
+func (s *Syntax) Channel(name string) (*Channel, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || !isBase64(name) {
+		return nil, errorInvalidChannelName(name)
+	}
+
+	s.channelsMutex.Lock()
+	defer s.channelsMutex.Unlock()
+
+	if _, exists := s.channels[name]; exists {
+		return nil, errorChannelExists(name)
+	}
+
+	channel := &Channel{
+		name:      name,
+		syntax:    s,
+		onJoin:    map[string]ChannelOnJoinFunc{},
+		onMessage: map[string]ChannelOnMessageFunc{},
+		topics:    map[string]*channelTopic{},
+	}
+	s.channels[name] = channel
+
+	return channel, nil
+}
+
+// getChannel obtém um channel registrado pelo nome
+func (s *Syntax) getChannel(name string) (*Channel, error) {
+	s.channelsMutex.RLock()
+	defer s.channelsMutex.RUnlock()
+
+	channel, exists := s.channels[name]
+	if !exists {
+		return nil, errorChannelNotFound(name)
+	}
+	return channel, nil
+}
@@ -0,0 +1,143 @@
+package syntax
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Channel_Join(t *testing.T) {
+	s := &Syntax{pubsub: &PubSub{}, channels: map[string]*Channel{}, sseReplay: newSSEReplay(0, 0)}
+	channel, _ := s.Channel("room")
+
+	banned := errors.New("banned")
+	var wildcard []string
+	channel.OnJoin("private", func(topic string, params map[string]interface{}, socket *Socket) error {
+		if params["user"] != "alex" {
+			return banned
+		}
+		return nil
+	})
+	channel.OnJoin("*", func(topic string, params map[string]interface{}, socket *Socket) error {
+		wildcard = append(wildcard, topic)
+		return nil
+	})
+
+	socket := &Socket{Channel: channel, conn: &testSocketConn{events: make(chan *SSEEvent, 10)}}
+
+	err := channel.requestJoin("private", map[string]interface{}{"user": "bob"}, socket)
+	joinError := &JoinError{}
+	if !errors.As(err, &joinError) || !errors.Is(err, banned) || joinError.Topic != "private" {
+		t.Errorf("Channel.requestJoin(topic) | expected JoinError\n   actual: %v", err)
+	}
+	if socket.Joined("private") {
+		t.Errorf("Channel.requestJoin(topic) | the refused socket must not be a member of the topic")
+	}
+	if len(wildcard) != 0 {
+		t.Errorf("Channel.requestJoin(topic) | the callback of the topic has priority over *\n   actual: %v", wildcard)
+	}
+
+	if err = channel.requestJoin("private", map[string]interface{}{"user": "alex"}, socket); err != nil || !socket.Joined("private") {
+		t.Errorf("Channel.requestJoin(topic) | expected join\n   actual: %v", err)
+	}
+
+	// fallback
+	if err = channel.requestJoin("lobby", nil, socket); err != nil || !socket.Joined("lobby") {
+		t.Errorf("Channel.requestJoin(topic) | expected join by *\n   actual: %v", err)
+	}
+	if len(wildcard) != 1 || wildcard[0] != "lobby" {
+		t.Errorf("Channel.requestJoin(topic) | the * callback must be used\n   actual: %v", wildcard)
+	}
+
+	// without callback
+	other, _ := s.Channel("other")
+	err = other.requestJoin("lobby", nil, &Socket{Channel: other})
+	if !errors.As(err, &joinError) || joinError.Reason != nil {
+		t.Errorf("Channel.requestJoin(topic) | expected JoinError without callback\n   actual: %v", err)
+	}
+}
+
+func Test_Channel_Leave_On_Disconnect(t *testing.T) {
+	s := &Syntax{pubsub: &PubSub{}, channels: map[string]*Channel{}, sseReplay: newSSEReplay(0, 0), sseHub: newSSEHub()}
+	go s.sseHub.run()
+
+	channel, _ := s.Channel("room")
+	channel.OnJoin("*", func(topic string, params map[string]interface{}, socket *Socket) error {
+		return nil
+	})
+	var left []string
+	channel.OnLeave(func(topic string, socket *Socket) {
+		left = append(left, topic)
+	})
+
+	conn := s.sseHub.subscribe(httptest.NewRequest("GET", "/live", nil), 0)
+	socket := conn.socket(channel)
+	if err := channel.requestJoin("lobby", nil, socket); err != nil {
+		t.Fatal(err)
+	}
+
+	// leaving a topic not joined does nothing
+	channel.requestLeave("other", socket)
+	if len(left) != 0 {
+		t.Errorf("Channel.requestLeave(topic) | OnLeave must not run for topics not joined\n   actual: %v", left)
+	}
+
+	conn.close()
+	if len(left) != 1 || left[0] != "lobby" {
+		t.Errorf("SSESubscription.close() | OnLeave must run when the connection drops\n   actual: %v", left)
+	}
+	if socket.Joined("lobby") || len(channel.topics) != 0 {
+		t.Errorf("SSESubscription.close() | the socket must leave the topics")
+	}
+	if topics := s.pubsub.(*PubSub).Topics(); len(topics) != 0 {
+		t.Errorf("SSESubscription.close() | the server must stop listening the topic\n   actual: %v", topics)
+	}
+}
+
+// blockingPubSub PubSub whose Subscribe waits to be released, like an adapter waiting for the network
+type blockingPubSub struct {
+	PubSub
+	subscribing chan bool
+	release     chan bool
+}
+
+func (p *blockingPubSub) Subscribe(topic string, callback func(content interface{})) (func(), error) {
+	p.subscribing <- true
+	<-p.release
+	return p.PubSub.Subscribe(topic, callback)
+}
+
+func Test_Channel_Join_Unlocked(t *testing.T) {
+	pubsub := &blockingPubSub{subscribing: make(chan bool), release: make(chan bool)}
+	s := &Syntax{pubsub: pubsub, channels: map[string]*Channel{}, sseReplay: newSSEReplay(0, 0)}
+	channel, _ := s.Channel("room")
+
+	socket := &Socket{Channel: channel, conn: &testSocketConn{events: make(chan *SSEEvent, 10)}}
+	joined := make(chan error)
+	go func() {
+		joined <- channel.join("lobby", socket)
+	}()
+	<-pubsub.subscribing
+
+	// the channel is not locked while subscribing
+	registered := make(chan error)
+	go func() {
+		registered <- channel.On("ping", func(topic string, params map[string]interface{}, socket *Socket) (interface{}, error) {
+			return nil, nil
+		})
+	}()
+	select {
+	case err := <-registered:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Channel.join(topic) | the channel must not be locked while subscribing")
+	}
+
+	pubsub.release <- true
+	if err := <-joined; err != nil || channel.topics["lobby"] == nil || !channel.topics["lobby"].sockets[socket] {
+		t.Errorf("Channel.join(topic) | the socket must join the topic\n   actual: %v", err)
+	}
+}
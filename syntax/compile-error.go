@@ -0,0 +1,151 @@
+package syntax
+
+import (
+	"bytes"
+	"github.com/syntax-framework/shtml/sht"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// compileErrorCodeRegex the code of the cmn.Err, `[textNode.interpolation] Error while...`
+var compileErrorCodeRegex = regexp.MustCompile(`^\[([^\]]+)]\s*`)
+
+// compileErrorFileRegex the position informed by sht.Node.DebugTag
+var compileErrorFileRegex = regexp.MustCompile(`File: "([^"]*)", Line: (\d+), Column: (\d+)`)
+
+// compileErrorPositionRegex the position informed by the html parser
+var compileErrorPositionRegex = regexp.MustCompile(`Line: (\d+), Column: (\d+)`)
+
+// compileErrorExcerptLines lines of the template shown before and after the line of the error
+const compileErrorExcerptLines = 3
+
+// compileError a template that failed to compile, shown in the browser in development
+type compileError struct {
+	Code    string
+	Message string
+	File    string
+	Line    int
+	Column  int
+	Excerpt []*compileErrorLine
+}
+
+// compileErrorLine a line of the source excerpt
+type compileErrorLine struct {
+	Number  int
+	Content string
+	Error   bool
+}
+
+// newCompileError extracts the code and the position from the error. The file is the page being compiled, unless
+// the error informs the file of the element (ex. a layout)
+func (s *Syntax) newCompileError(err error, file string) *compileError {
+	message := err.Error()
+	info := &compileError{Message: message, File: file}
+
+	if match := compileErrorCodeRegex.FindStringSubmatch(message); match != nil {
+		info.Code = match[1]
+		info.Message = message[len(match[0]):]
+	}
+
+	if match := compileErrorFileRegex.FindStringSubmatch(message); match != nil {
+		info.File = match[1]
+		info.Line, _ = strconv.Atoi(match[2])
+		info.Column, _ = strconv.Atoi(match[3])
+	} else if match = compileErrorPositionRegex.FindStringSubmatch(message); match != nil {
+		info.Line, _ = strconv.Atoi(match[1])
+		info.Column, _ = strconv.Atoi(match[2])
+	}
+
+	if info.Line > 0 && info.File != "" {
+		if source, errLoad := s.loadFile(info.File); errLoad == nil {
+			lines := strings.Split(source, "\n")
+			first := info.Line - compileErrorExcerptLines
+			if first < 1 {
+				first = 1
+			}
+			last := info.Line + compileErrorExcerptLines
+			if last > len(lines) {
+				last = len(lines)
+			}
+			for number := first; number <= last; number++ {
+				info.Excerpt = append(info.Excerpt, &compileErrorLine{
+					Number:  number,
+					Content: lines[number-1],
+					Error:   number == info.Line,
+				})
+			}
+		}
+	}
+	return info
+}
+
+// renderCompileError responds with the overlay of the compile error. The page has the live reload script, the
+// overlay is cleared when the file is fixed. Outside development, responds with the 500 page.
+func (s *Syntax) renderCompileError(w http.ResponseWriter, r *http.Request, err error, file string) {
+	if !s.Config.Dev {
+		log.Printf("[syntax] unable to compile the page %s. %s", file, err)
+		s.renderError(w, r, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	info := s.newCompileError(err, file)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(`<!DOCTYPE html><html lang="en"><head><meta charset="UTF-8"><title>Compile Error</title>`)
+	buf.WriteString(`<style>`)
+	buf.WriteString(`body{margin:0;background:#1e1e1e;color:#eee;font:14px/1.5 monospace}`)
+	buf.WriteString(`.stx-error{max-width:960px;margin:40px auto;padding:24px;border-top:4px solid #e54848;background:#282828}`)
+	buf.WriteString(`.stx-error h1{margin:0 0 8px;font-size:18px;color:#ff6b6b}`)
+	buf.WriteString(`.stx-error .stx-file{color:#aaa}`)
+	buf.WriteString(`.stx-error pre{white-space:pre-wrap;margin:16px 0}`)
+	buf.WriteString(`.stx-error .stx-line{display:block;color:#888}`)
+	buf.WriteString(`.stx-error .stx-line-error{color:#fff;background:#5a1f1f}`)
+	buf.WriteString(`</style></head><body><div class="stx-error">`)
+
+	buf.WriteString(`<h1>` + sht.HtmlEscape(info.Code) + `</h1>`)
+
+	buf.WriteString(`<div class="stx-file">` + sht.HtmlEscape(info.File))
+	if info.Line > 0 {
+		buf.WriteString(":" + strconv.Itoa(info.Line) + ":" + strconv.Itoa(info.Column))
+	}
+	buf.WriteString(`</div>`)
+
+	buf.WriteString(`<pre class="stx-message">` + sht.HtmlEscape(info.Message) + `</pre>`)
+
+	if len(info.Excerpt) > 0 {
+		width := len(strconv.Itoa(info.Excerpt[len(info.Excerpt)-1].Number))
+		buf.WriteString(`<pre class="stx-excerpt">`)
+		for _, line := range info.Excerpt {
+			number := strconv.Itoa(line.Number)
+			number = strings.Repeat(" ", width-len(number)) + number
+			if line.Error {
+				buf.WriteString(`<span class="stx-line stx-line-error">&gt; ` + number + ` | `)
+			} else {
+				buf.WriteString(`<span class="stx-line">  ` + number + ` | `)
+			}
+			buf.WriteString(sht.HtmlEscape(line.Content) + `</span>`)
+			if line.Error && info.Column > 0 {
+				buf.WriteString(`<span class="stx-line stx-line-error">  ` + strings.Repeat(" ", width) + ` | `)
+				buf.WriteString(strings.Repeat(" ", info.Column-1) + `^</span>`)
+			}
+		}
+		buf.WriteString(`</pre>`)
+	}
+
+	buf.WriteString(`</div>`)
+	// live reload
+	buf.WriteString(s.Bundler.GetScripts(""))
+	buf.WriteString(`</body></html>`)
+
+	content := buf.Bytes()
+	header := w.Header()
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(http.StatusInternalServerError)
+	if _, errWrite := w.Write(content); errWrite != nil {
+		log.Println(errWrite)
+	}
+}
@@ -0,0 +1,57 @@
+package syntax
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_Compile_Error_Overlay(t *testing.T) {
+	s := newTestSyntax(map[string]string{
+		"broken.html":        "<page></page>\n<div>\n  <b>{a +}</b>\n</div>",
+		"/_layout/root.html": `!{content}`,
+	})
+	s.Config.Dev = true
+	s.initErrorPages()
+	if err := s.servePages(); err != nil {
+		t.Fatalf("Syntax.servePages() | the server must keep running in development\n   actual: %s", err)
+	}
+	s.serving = true
+
+	get := func() (int, string) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/broken.html", nil))
+		return w.Code, w.Body.String()
+	}
+
+	code, body := get()
+	if code != http.StatusInternalServerError {
+		t.Errorf("Syntax.renderCompileError() | invalid status\n   actual: %d", code)
+	}
+	for _, expected := range []string{
+		`<h1>textNode.interpolation</h1>`,
+		`<div class="stx-file">broken.html:3:2</div>`,
+		`<span class="stx-line stx-line-error">&gt; 3 |   &lt;b&gt;{a +}&lt;/b&gt;</span>`,
+		`<span class="stx-line">  1 | &lt;page&gt;&lt;/page&gt;</span>`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Syntax.renderCompileError() | invalid output\n   actual: %s\n expected: %s", body, expected)
+		}
+	}
+
+	// fixed
+	fsys := s.FileSystems[0].fs.(fstest.MapFS)
+	fsys["broken.html"] = &fstest.MapFile{Data: []byte("<page></page><b>fixed</b>")}
+	s.reloadFiles([]string{"/broken.html"})
+	if code, body = get(); code != http.StatusOK || body != "<b>fixed</b>" {
+		t.Errorf("Syntax.reloadFiles() | the error must be cleared\n   actual: %d %s", code, body)
+	}
+
+	// outside development, fails to start
+	s = newTestSyntax(map[string]string{"broken.html": "<b>{a +}</b>"})
+	if err := s.servePages(); err == nil || !strings.Contains(err.Error(), "textNode.interpolation") {
+		t.Errorf("Syntax.servePages() | compile error expected\n   actual: %v", err)
+	}
+}
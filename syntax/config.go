@@ -33,27 +33,59 @@ type ConfigCookie struct {
 // create all ActiveSupport::MessageVerifier and ActiveSupport::MessageEncryptor instances, including the ones
 // that sign and encrypt cookies.
 //
-// In development and test, this is randomly generated and stored in a temporary file in tmp/development_secret.txt.
+// In development and test, this is randomly generated and stored in the cache directory of the user, one secret for
+// each site directory.
 //
 // In all other environments, we look for it first in ENV["SECRET_KEY_BASE"], then credentials.secret_key_base,
 // and finally secrets.secret_key_base. For most applications, the correct place to store it is in the encrypted
 // credentials file.
-//SecretKeyBase string
 
 type Config struct {
-	Dev          bool             `yaml:"dev"`
-	Cookie       ConfigCookie     `yaml:"cookie"`
-	ServerTiming string           `yaml:"server-timing"`
-	LiveEndpoint string           `yaml:"live-endpoint"`
-	LiveReload   ConfigLiveReload `yaml:"live-reload"`
+	Dev            bool             `yaml:"dev"`
+	SecretKeyBase  string           `yaml:"secret-key-base"` // At least 64 bytes. See the comment above.
+	Cookie         ConfigCookie     `yaml:"cookie"`
+	ServerTiming   string           `yaml:"server-timing"`
+	LiveEndpoint   string           `yaml:"live-endpoint"`
+	LiveReplaySize int              `yaml:"live-replay-size"` // Max events per topic kept to be replayed on reconnection. Defaults to `100`.
+	LiveReplayAge  int              `yaml:"live-replay-age"`  // Seconds an event is kept to be replayed on reconnection. Defaults to `300`.
+	LiveKeepAlive  int              `yaml:"live-keep-alive"`  // Seconds between keep-alive comments sent on idle connections. Defaults to `15`.
+	LiveTransport  string           `yaml:"live-transport"`   // "websocket" (falls back to SSE when not available) or "sse". Defaults to `websocket`.
+	LiveReload     ConfigLiveReload `yaml:"live-reload"`
+	PubSub         ConfigPubSub     `yaml:"pubsub"`
+	PersistDir     string           `yaml:"persist-dir"` // Directory of the logs of the persistent topics. Defaults to `data/topics`.
+	Controller     ConfigController `yaml:"controller"`
+	ModelCacheSize int              `yaml:"model-cache-size"` // Max results kept in the in-memory cache of models. Defaults to `1000`.
+	ModelTimeout   int              `yaml:"model-timeout"`    // Millis to load the models of a page, besides the request deadline. Defaults to `0` (no limit).
+	ModelFailure   string           `yaml:"model-failure"`    // When a model fails: "error" (500), "unavailable" (503) or "fallback". Defaults to `error`.
+}
+
+// modelFailurePolicy the default ModelFailurePolicy of the models
+func (c *Config) modelFailurePolicy() ModelFailurePolicy {
+	switch strings.ToLower(strings.TrimSpace(c.ModelFailure)) {
+	case "unavailable", "503":
+		return ModelFailureUnavailable
+	case "fallback":
+		return ModelFailureFallback
+	}
+	return ModelFailureError
+}
+
+type ConfigController struct {
+	EncryptParams bool `yaml:"encrypt-params"` // Encrypts the params of live controllers, otherwise they are only signed.
+	ParamsMaxAge  int  `yaml:"params-max-age"` // Seconds the params of live controllers can be used to reconnect. Defaults to `86400`.
+}
+
+type ConfigPubSub struct {
+	Network string `yaml:"network"` // Network of the PubSubBroker, "tcp" or "unix". Defaults to `tcp`.
+	Address string `yaml:"address"` // Address of the PubSubBroker. When empty, the in-process PubSub is used.
 }
 
 type ConfigLiveReload struct {
-	Disabled  bool     `yaml:"disabled"`   // Allows you to disable LiveReload entirely
+	Disabled  bool     `yaml:"disabled"`   // Disables the reload of the browser, changed pages are still compiled again
 	Interval  int      `yaml:"interval"`   // Millis to wait on client to refresh when receive update. Defaults to `100`.
 	Debounce  int      `yaml:"debounce"`   // Millis to wait before sending live reload events to the browser. Defaults to `0`.
-	Pattern   []string `yaml:"pattern"`    // A list of patterns to trigger the live reloading. This option is required to enable any live reloading
-	Endpoint  string   `yaml:"endpoint"`   // Endpoint of the live reload SSE event. Defaults to `dev.livereload`.
+	Pattern   []string `yaml:"pattern"`    // Regular expressions of the paths (ex. `/assets/css/site.css`) that trigger the live reloading. Defaults to html, js, css and images.
+	Endpoint  string   `yaml:"endpoint"`   // Endpoint of the live reload SSE event. Defaults to `/dev.livereload`.
 	ReloadCss bool     `yaml:"reload-css"` // If true, CSS changes will trigger a full page reload. Defaults to false.
 }
 
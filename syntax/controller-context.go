@@ -0,0 +1,159 @@
+package syntax
+
+import (
+	"github.com/syntax-framework/chain"
+	"github.com/syntax-framework/chain/middlewares/session"
+	"github.com/syntax-framework/shtml/cmn"
+	"github.com/syntax-framework/shtml/sht"
+	"net/http"
+	"sync"
+)
+
+// RequestContextKey key of the *chain.Context of the request in the sht.Context, available while rendering a page
+const RequestContextKey = "syntax.request"
+
+var errorControllerNotLive = cmn.Err(
+	"controller.live.required",
+	"Only live controllers can subscribe to topics.", "Controller: %s", "Topic: %s",
+)
+
+var errorControllerMount = cmn.Err(
+	"controller.mount",
+	"The Mount hook of the controller failed.", "Controller: %s", "Cause: %s",
+)
+
+// ControllerHooks lifecycle of a controller.
+//
+// Mount and HandleParams are executed when the element is rendered (and when a live controller is rebuilt). In live
+// controllers, HandleEvent receives the events sent by the client, HandleInfo receives the messages of the topics
+// subscribed with ControllerContext.Subscribe and Terminate is executed when the client disconnects. After
+// HandleEvent and HandleInfo, the element is rendered again and the client receives the changes.
+type ControllerHooks struct {
+	Mount        func(ctx *ControllerContext) error
+	HandleParams func(ctx *ControllerContext, params map[string]interface{})
+	HandleEvent  func(ctx *ControllerContext, event string, params map[string]interface{}) error
+	HandleInfo   func(ctx *ControllerContext, topic string, content interface{})
+	Terminate    func(ctx *ControllerContext)
+}
+
+// ControllerContext gives the hooks of a controller access to the request, the session and the PubSub
+type ControllerContext struct {
+	Controller *Controller
+	Scope      *sht.Scope
+	Params     map[string]interface{}
+	Request    *http.Request     // the request of the page or, in live controllers, of the live connection
+	Route      map[string]string // route params of the page, see pageRoutePath
+	chain      *chain.Context
+	syntax     *Syntax
+	info       func(topic string, content interface{})
+	mutex      sync.Mutex
+	subscribed map[string]func() // unsubscribe by topic
+}
+
+// newControllerContext creates the context of a controller rendered in the scope. The request, when rendering a page,
+// is obtained from the sht.Context (see RequestContextKey)
+func (s *Syntax) newControllerContext(controller *Controller, scope *sht.Scope, params map[string]interface{}) *ControllerContext {
+	ctx := &ControllerContext{
+		Controller: controller,
+		Scope:      scope,
+		Params:     params,
+		syntax:     s,
+	}
+	if requestCtx, isRequest := scope.Context.Get(RequestContextKey).(*chain.Context); isRequest {
+		ctx.chain = requestCtx
+		ctx.Request = requestCtx.Request
+	}
+	ctx.Route, _ = scope.Context.Get(RouteParamsKey).(map[string]string)
+	return ctx
+}
+
+// Param value of a route param of the page
+func (c *ControllerContext) Param(name string) string {
+	return c.Route[name]
+}
+
+// Session data of the session of the user (see session.Fetch), available while the page is rendered. Requires the
+// session middleware. The live connection doesn't carry the session of the application, in live controllers returns
+// nil in the hooks executed after the render (HandleEvent, HandleInfo, Terminate) and when the controller is rebuilt.
+func (c *ControllerContext) Session() map[string]interface{} {
+	if c.chain == nil {
+		return nil
+	}
+	if sess, err := session.Fetch(c.chain); err == nil && sess != nil {
+		return sess.GetMap()
+	}
+	return nil
+}
+
+// Subscribe subscribes the live controller to the topic, the messages are received by ControllerHooks.HandleInfo.
+// The subscriptions are removed when the controller terminates.
+func (c *ControllerContext) Subscribe(topic string) error {
+	if c.info == nil {
+		return errorControllerNotLive(c.Controller.Name, topic)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, exists := c.subscribed[topic]; exists {
+		return nil
+	}
+
+	unsubscribe, err := c.syntax.Subscribe(topic, func(content interface{}) {
+		c.info(topic, content)
+	})
+	if err != nil {
+		return err
+	}
+	if c.subscribed == nil {
+		c.subscribed = map[string]func(){}
+	}
+	c.subscribed[topic] = unsubscribe
+	return nil
+}
+
+// Unsubscribe removes the subscription to the topic
+func (c *ControllerContext) Unsubscribe(topic string) {
+	c.mutex.Lock()
+	unsubscribe := c.subscribed[topic]
+	delete(c.subscribed, topic)
+	c.mutex.Unlock()
+
+	if unsubscribe != nil {
+		unsubscribe()
+	}
+}
+
+// mount runs the hooks executed when the element is rendered. When Mount fails, the render fails with the error
+// (see controllerFailed)
+func (c *ControllerContext) mount() {
+	hooks := c.Controller.Hooks
+	if hooks == nil {
+		return
+	}
+	if hooks.Mount != nil {
+		if err := hooks.Mount(c); err != nil {
+			controllerFailed(c.Scope.Context, errorControllerMount(c.Controller.Name, err.Error()))
+			return
+		}
+	}
+	if hooks.HandleParams != nil {
+		hooks.HandleParams(c, c.Params)
+	}
+}
+
+// terminate removes all subscriptions of the controller and runs the Terminate hook
+func (c *ControllerContext) terminate() {
+	c.mutex.Lock()
+	subscribed := c.subscribed
+	c.subscribed = nil
+	c.mutex.Unlock()
+
+	for _, unsubscribe := range subscribed {
+		unsubscribe()
+	}
+
+	if c.Controller.Hooks != nil && c.Controller.Hooks.Terminate != nil {
+		c.Controller.Hooks.Terminate(c)
+	}
+}
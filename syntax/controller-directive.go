@@ -4,6 +4,7 @@ import (
 	"github.com/iancoleman/strcase"
 	"github.com/syntax-framework/shtml/cmn"
 	"github.com/syntax-framework/shtml/sht"
+	"log"
 	"strings"
 )
 
@@ -12,28 +13,71 @@ var errorControllerNotFound = cmn.Err(
 	"There is no controller registered with the given name.", "Name: %s", "Component: %s",
 )
 
+// pageControllersKey key, in the compile context, of the names of the controllers used by the page
+const pageControllersKey = "syntax.page.controllers"
+
+// pageControllers names of the controllers used by the template being compiled
+func pageControllers(ctx *sht.Context) map[string]bool {
+	if names, exists := ctx.Get(pageControllersKey).(map[string]bool); exists {
+		return names
+	}
+	names := map[string]bool{}
+	ctx.Set(pageControllersKey, names)
+	return names
+}
+
+// controllerErrorKey key, in the sht.Context, of the error of a controller that failed while rendering. The render
+// fails with the error (see Syntax.writePage and Syntax.rebuildLiveController)
+const controllerErrorKey = "syntax.controller.error"
+
+// controllerFailed records the error of the controller, only the first error of the render is kept
+func controllerFailed(ctx *sht.Context, err error) {
+	if controllerError(ctx) == nil {
+		ctx.Set(controllerErrorKey, err)
+	}
+}
+
+// controllerError the error of the controllers rendered in the context
+func controllerError(ctx *sht.Context) error {
+	err, _ := ctx.Get(controllerErrorKey).(error)
+	return err
+}
+
 func (s *Syntax) CreateControllerDirectives() []*sht.Directive {
 
 	elementDirective := &sht.Directive{
 		Name:       "controller",
 		Restrict:   sht.ATTRIBUTE,
 		Priority:   200,
-		Terminal:   false,
-		Transclude: false,
+		Terminal:   true,
+		Transclude: "element",
 		Compile: func(node *sht.Node, attrs *sht.Attributes, t *sht.Compiler) (methods *sht.DirectiveMethods, err error) {
 
 			name := attrs.Get("controller")
-			attrs.Remove(attrs.GetAttribute("controller"))
 
-			var controller *Controller
-			for _, ctrl := range s.Controllers {
-				if ctrl.Name == name {
-					controller = ctrl
+			controller := s.getController(name)
+			if controller == nil {
+				err = errorControllerNotFound(name, node.DebugTag())
+				return
+			}
+			pageControllers(t.Context)[name] = true
+
+			// source of the element, used to rebuild the live controller when the client reconnects
+			templateKey := ""
+			if controller.isLive() {
+				source, errRender := node.Render()
+				if errRender != nil {
+					err = errRender
+					return
 				}
+				templateKey = s.liveControllers.register(source)
 			}
 
-			if controller == nil {
-				err = errorControllerNotFound(name, node.DebugTag())
+			attrs.Remove(attrs.GetAttribute("controller"))
+
+			tag := node.DebugTag()
+			expressions, err := controller.compileParams(attrs, tag)
+			if err != nil {
 				return
 			}
 
@@ -43,22 +87,88 @@ func (s *Syntax) CreateControllerDirectives() []*sht.Directive {
 					for attrName, attr := range attrs.Map {
 						if strings.HasPrefix(attrName, "param-") {
 							paramName := strcase.ToLowerCamel(strings.Replace(attrName, "param-", "", 1))
-							params[paramName] = attr.Value
+							if expression, isExpression := expressions[paramName]; isExpression {
+								params[paramName] = expression.Exec(scope)
+							} else {
+								params[paramName] = attr.Value
+							}
 							attrs.Remove(attr)
 						}
 					}
 
-					controller.Setup(scope, params)
+					// client reconnecting, params are the ones signed on the first render
+					rebuild, _ := scope.Context.Get(liveRebuildKey).(*liveRebuild)
+					if !controller.isLive() || rebuild == nil || rebuild.instance != nil || rebuild.controller != controller.Name {
+						rebuild = nil
+					}
+
+					if rebuild != nil {
+						params = rebuild.params
+						scope.Context.Set(liveRebuildKey, nil)
+					}
+					params, errParams := controller.coerceParams(params, tag)
+					if errParams != nil {
+						// the controller never runs with values of other types, the render fails with the error
+						controllerFailed(scope.Context, errParams)
+						return nil
+					}
+
+					if !controller.isLive() {
+						ctx := s.newControllerContext(controller, scope, params)
+						rendered := transclude("", func(scope *sht.Scope) {
+							ctx.Scope = scope
+							if controller.Setup != nil {
+								controller.Setup(scope, params)
+							}
+							ctx.mount()
+						})
+						ctx.terminate()
+						return rendered
+					}
+
+					// is live controller
+					id := ""
+					if rebuild != nil {
+						id = rebuild.id
+					}
+					instance := s.liveControllers.create(id, controller, params)
+					instance.context = s.newControllerContext(controller, scope, params)
+					instance.context.info = instance.info
+					if rebuild != nil {
+						instance.context.Request = rebuild.request
+						rebuild.instance = instance
+					}
 
-					if controller.Live != nil {
-						// is live controller
-						// serialize params to allow reconnection
-						attrs.Set("data-stx-ctrl", controller.Name)
-						attrs.Set("data-stx-ctrl-par", "parametros serializado, todo")
+					// serialize params to allow reconnection
+					attrs.Set("data-stx-ctrl", controller.Name)
+					if s.controllerParams != nil {
+						token, errToken := s.controllerParams.encode(controller.Name, templateKey, params, instance.context.Route)
+						if errToken != nil {
+							log.Printf("[syntax] unable to serialize the params of controller %s. %s", controller.Name, errToken)
+						} else {
+							attrs.Set("data-stx-ctrl-par", token)
+						}
 					}
+					attrs.Set("data-stx-live", instance.id)
+
+					instance.mutex.Lock()
+					defer instance.mutex.Unlock()
 
-					return nil
-					//return transclude("", nil)
+					instance.rendered = transclude("", instance.setup)
+					if controllerError(scope.Context) != nil {
+						// the client never connects to a controller that failed
+						s.liveControllers.remove(instance.id)
+						return nil
+					}
+					// the request context is reused after the page is rendered
+					instance.context.chain = nil
+					instance.render = func() *sht.Rendered {
+						// same scope on all renders, the handlers of LiveState change the values of that scope
+						return transclude("", func(scope *sht.Scope) {
+							*scope = *instance.scope
+						})
+					}
+					return instance.rendered
 				},
 			}
 
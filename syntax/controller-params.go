@@ -0,0 +1,196 @@
+package syntax
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/syntax-framework/chain"
+	"github.com/syntax-framework/shtml/cmn"
+	"github.com/syntax-framework/shtml/sht"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// developmentSecretFile file where the SecretKeyBase generated in development is kept between restarts, in the cache
+// directory of the user. Outside the site directories, which are versioned and watched by the live reload.
+const developmentSecretFile = "development_secret.txt"
+
+var errorSecretKeyBaseEmpty = cmn.Err(
+	"config.secret.empty",
+	"The SecretKeyBase is required to sign the params of live controllers.",
+	"Action: Set `secret-key-base` in config.yaml or the SECRET_KEY_BASE environment variable",
+)
+
+var errorSecretKeyBaseLength = cmn.Err(
+	"config.secret.length",
+	"The SecretKeyBase must be at least 64 bytes.", "Length: %d",
+)
+
+var errorControllerParamsInvalid = cmn.Err(
+	"controller.params.invalid",
+	"The params of the controller are not valid, they were changed or signed with another secret.", "Cause: %s",
+)
+
+var errorControllerParamsExpired = cmn.Err(
+	"controller.params.expired",
+	"The params of the controller have expired, the page must be reloaded.", "Controller: %s", "Expired: %s",
+)
+
+// controllerParamsToken content of the `data-stx-ctrl-par` attribute, allows rebuilding a live controller when the
+// client reconnects
+type controllerParamsToken struct {
+	Controller string                 `json:"c"`
+	Template   string                 `json:"t"` // key of the element template, see liveControllers.templates
+	Params     map[string]interface{} `json:"p"`
+	Route      map[string]string      `json:"r,omitempty"` // route params of the page
+	Expires    int64                  `json:"e"`           // unix seconds
+}
+
+// controllerParamsCodec signs, or signs and encrypts, the params of live controllers with keys derived from the
+// SecretKeyBase
+type controllerParamsCodec struct {
+	signKey    []byte
+	encryptKey []byte // nil when the params are only signed
+	maxAge     time.Duration
+}
+
+// initSecretKeyBase resolves the SecretKeyBase of the application, from the config or from the SECRET_KEY_BASE
+// environment variable. In development, a random secret is generated and kept in the cache directory of the user,
+// one for each site directory (see developmentSecretPath).
+func (s *Syntax) initSecretKeyBase() error {
+	secret := strings.TrimSpace(s.Config.SecretKeyBase)
+	if secret == "" {
+		secret = strings.TrimSpace(os.Getenv("SECRET_KEY_BASE"))
+	}
+	if secret == "" && s.Config.Dev {
+		if file := s.developmentSecretPath(); file != "" {
+			var err error
+			if secret, err = developmentSecret(file); err != nil {
+				return err
+			}
+		}
+	}
+
+	if secret == "" {
+		for _, controller := range s.Controllers {
+			if controller.isLive() {
+				return errorSecretKeyBaseEmpty()
+			}
+		}
+		return nil
+	}
+
+	if len(secret) < 64 {
+		return errorSecretKeyBaseLength(len(secret))
+	}
+
+	s.Config.SecretKeyBase = secret
+	s.router.SecretKeyBase = secret
+	s.controllerParams = newControllerParamsCodec(secret, s.Config.Controller)
+	return nil
+}
+
+// developmentSecretPath the file of the secret generated in development, by the site directory with the highest
+// priority (ex. `~/.cache/syntax/<hash of the directory>/development_secret.txt`). Empty when the site has no
+// directory on disk (embed only), the SecretKeyBase must be configured.
+func (s *Syntax) developmentSecretPath() string {
+	for _, system := range s.FileSystems {
+		if system.dir == "" {
+			continue
+		}
+		dir, err := filepath.Abs(system.dir)
+		if err != nil {
+			dir = system.dir
+		}
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			cache = os.TempDir()
+		}
+		return filepath.Join(cache, "syntax", sht.HashXXH64Hex(dir), developmentSecretFile)
+	}
+	return ""
+}
+
+// developmentSecret reads or generates the secret used in development
+func developmentSecret(file string) (string, error) {
+	if content, err := os.ReadFile(file); err == nil {
+		if secret := strings.TrimSpace(string(content)); secret != "" {
+			return secret, nil
+		}
+	}
+
+	bytes := make([]byte, 64)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(bytes)
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(file, []byte(secret), 0600); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+func newControllerParamsCodec(secret string, config ConfigController) *controllerParamsCodec {
+	maxAge := time.Duration(config.ParamsMaxAge) * time.Second
+	if maxAge <= 0 {
+		maxAge = 24 * time.Hour
+	}
+
+	codec := &controllerParamsCodec{
+		signKey: chain.KeyGenerator.Generate([]byte(secret), []byte("stx controller params signing"), 1000, 32, "sha256"),
+		maxAge:  maxAge,
+	}
+	if config.EncryptParams {
+		codec.encryptKey = chain.KeyGenerator.Generate([]byte(secret), []byte("stx controller params encryption"), 1000, 32, "sha256")
+	}
+	return codec
+}
+
+// encode serializes and signs the params
+func (c *controllerParamsCodec) encode(controller string, template string, params map[string]interface{}, route map[string]string) (string, error) {
+	data, err := json.Marshal(&controllerParamsToken{
+		Controller: controller,
+		Template:   template,
+		Params:     params,
+		Route:      route,
+		Expires:    time.Now().Add(c.maxAge).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if c.encryptKey != nil {
+		return chain.MessageEncryptor.Encrypt(data, c.encryptKey, c.signKey)
+	}
+	return chain.MessageVerifier.Sign(data, c.signKey, "sha256"), nil
+}
+
+// decode verifies the signature and the expiration of the params sent back by the client
+func (c *controllerParamsCodec) decode(token string) (*controllerParamsToken, error) {
+	var data []byte
+	var err error
+	if c.encryptKey != nil {
+		data, err = chain.MessageEncryptor.Decrypt([]byte(token), c.encryptKey, c.signKey)
+	} else {
+		data, err = chain.MessageVerifier.Verify([]byte(token), c.signKey)
+	}
+	if err != nil {
+		return nil, errorControllerParamsInvalid(err.Error())
+	}
+
+	decoded := &controllerParamsToken{}
+	if err = json.Unmarshal(data, decoded); err != nil {
+		return nil, errorControllerParamsInvalid(err.Error())
+	}
+
+	if expires := time.Unix(decoded.Expires, 0); time.Now().After(expires) {
+		return nil, errorControllerParamsExpired(decoded.Controller, expires.Format(time.RFC3339))
+	}
+	return decoded, nil
+}
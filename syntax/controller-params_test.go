@@ -0,0 +1,85 @@
+package syntax
+
+import (
+	"github.com/syntax-framework/chain/middlewares/session"
+	"github.com/syntax-framework/shtml/sht"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_Development_Secret(t *testing.T) {
+	site := t.TempDir()
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+
+	secret := func() string {
+		s := newTestSyntax(nil)
+		s.Config.Dev = true
+		s.AddFileSystemDir(site, 0)
+		if err := s.initSecretKeyBase(); err != nil {
+			t.Fatal(err)
+		}
+		return s.Config.SecretKeyBase
+	}
+
+	first := secret()
+	if len(first) < 64 {
+		t.Fatalf("Syntax.initSecretKeyBase() | invalid secret\n   actual: %s", first)
+	}
+	s := newTestSyntax(nil)
+	s.AddFileSystemDir(site, 0)
+	file := s.developmentSecretPath()
+	if !strings.HasPrefix(file, cache) {
+		t.Errorf("Syntax.initSecretKeyBase() | the secret must be kept in the cache directory\n   actual: %s", file)
+	}
+	if content, err := os.ReadFile(file); err != nil || string(content) != first {
+		t.Errorf("Syntax.initSecretKeyBase() | invalid secret file\n   error: %v", err)
+	}
+	if entries, _ := os.ReadDir(site); len(entries) != 0 {
+		t.Errorf("Syntax.initSecretKeyBase() | nothing must be written in the site directory\n   actual: %d files", len(entries))
+	}
+
+	// started from another directory
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if second := secret(); second != first {
+		t.Errorf("Syntax.initSecretKeyBase() | the secret must not depend on the working directory")
+	}
+
+	// without a site directory, the secret must be configured
+	s = newTestSyntax(nil)
+	s.Config.Dev = true
+	s.Controllers = append(s.Controllers, &Controller{Name: "counter", Live: func(scope *sht.Scope, params map[string]interface{}, live *LiveState) {}})
+	if err := s.initSecretKeyBase(); err == nil {
+		t.Errorf("Syntax.initSecretKeyBase() | expected error without SecretKeyBase")
+	}
+}
+
+func Test_Live_Session_Secret(t *testing.T) {
+	s := newTestSyntax(nil)
+	s.AddFileSystemEmbed(syntaxDefaultFiles, "static/", -1)
+	s.Config.SecretKeyBase = strings.Repeat("secret", 11)
+	s.pubsub = &PubSub{}
+	s.channels = map[string]*Channel{}
+	s.sseReplay = newSSEReplay(0, 0)
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	var store *session.Cookie
+	for _, args := range s.middlewares {
+		for _, arg := range args {
+			if manager, isManager := arg.(*session.Manager); isManager {
+				store = manager.Store.(*session.Cookie)
+			}
+		}
+	}
+	if store == nil || store.SecretKeyBase != s.Config.SecretKeyBase {
+		t.Errorf("Syntax.initLiveServer() | the live session must be signed with the SecretKeyBase\n   actual: %+v", store)
+	}
+}
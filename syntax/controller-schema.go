@@ -0,0 +1,409 @@
+package syntax
+
+import (
+	"fmt"
+	"github.com/iancoleman/strcase"
+	"github.com/syntax-framework/shtml/cmn"
+	"github.com/syntax-framework/shtml/sht"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errorControllerParamsSchema = cmn.Err(
+	"controller.params.schema",
+	"The params schema of the controller is not valid.", "Controller: %s", "Cause: %s",
+)
+
+var errorControllerParamRequired = cmn.Err(
+	"controller.param.required",
+	"The controller requires the param.", "Controller: %s", "Param: %s", "Tag: %s",
+)
+
+var errorControllerParamUnknown = cmn.Err(
+	"controller.param.unknown",
+	"The controller does not declare the param.", "Controller: %s", "Param: %s", "Tag: %s",
+)
+
+var errorControllerParamType = cmn.Err(
+	"controller.param.type",
+	"The value of the param is not valid for its type.", "Controller: %s", "Param: %s", "Type: %s", "Value: %v", "Tag: %s",
+)
+
+var errorControllerParamExpression = cmn.Err(
+	"controller.param.expression",
+	"The expression of the param is not valid.", "Controller: %s", "Param: %s", "Cause: %s", "Tag: %s",
+)
+
+// ParamType the type of controller param, the values of the attributes are converted to this type
+type ParamType uint8
+
+const (
+	ParamString      ParamType = iota // string
+	ParamInt                          // int
+	ParamFloat                        // float64
+	ParamBool                         // bool, an attribute without value is true
+	ParamTime                         // time.Time, RFC 3339 or "2006-01-02"
+	ParamStringSlice                  // []string, comma separated
+	ParamIntSlice                     // []int, comma separated
+)
+
+var paramTypeNames = map[ParamType]string{
+	ParamString:      "string",
+	ParamInt:         "int",
+	ParamFloat:       "float",
+	ParamBool:        "bool",
+	ParamTime:        "time",
+	ParamStringSlice: "[]string",
+	ParamIntSlice:    "[]int",
+}
+
+func (t ParamType) String() string {
+	return paramTypeNames[t]
+}
+
+// ControllerParam declares a param of the controller, `param-user-id="1"` is the param `userId`
+type ControllerParam struct {
+	Name     string
+	Type     ParamType
+	Required bool
+	Default  interface{} // used when the param is not informed
+}
+
+// DeclareParams declares the params accepted by the controller. The schema is a []*ControllerParam or a struct, whose
+// fields are declared with the tag `param:"name,required"`
+//
+//	type UserCardParams struct {
+//		UserID  int       `param:"userId,required"`
+//		Tags    []string  `param:"tags"`
+//		Since   time.Time `param:"since"`
+//	}
+//
+//	controller, _ := syntax.RegisterController("user-card", setup, nil)
+//	controller.DeclareParams(UserCardParams{})
+func (c *Controller) DeclareParams(schema interface{}) error {
+	if params, isParams := schema.([]*ControllerParam); isParams {
+		for _, param := range params {
+			if param == nil {
+				return errorControllerParamsSchema(c.Name, "nil param")
+			}
+			if strings.TrimSpace(param.Name) == "" {
+				return errorControllerParamsSchema(c.Name, "param without name")
+			}
+		}
+		if err := c.checkDuplicateParams(params); err != nil {
+			return err
+		}
+		c.Params = params
+		return nil
+	}
+
+	schemaType := reflect.TypeOf(schema)
+	if schemaType != nil && schemaType.Kind() == reflect.Pointer {
+		schemaType = schemaType.Elem()
+	}
+	if schemaType == nil || schemaType.Kind() != reflect.Struct {
+		return errorControllerParamsSchema(c.Name, fmt.Sprintf("unsupported schema %T", schema))
+	}
+
+	var params []*ControllerParam
+	for i := 0; i < schemaType.NumField(); i++ {
+		field := schemaType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		param := &ControllerParam{Name: strcase.ToLowerCamel(field.Name)}
+		if tag, hasTag := field.Tag.Lookup("param"); hasTag {
+			if tag == "-" {
+				continue
+			}
+			parts := strings.Split(tag, ",")
+			if name := strings.TrimSpace(parts[0]); name != "" {
+				param.Name = name
+			}
+			for _, option := range parts[1:] {
+				if strings.TrimSpace(option) == "required" {
+					param.Required = true
+				}
+			}
+		}
+
+		paramType, supported := paramTypeOf(field.Type)
+		if !supported {
+			return errorControllerParamsSchema(c.Name, fmt.Sprintf("unsupported type %s of field %s", field.Type, field.Name))
+		}
+		param.Type = paramType
+		params = append(params, param)
+	}
+	if err := c.checkDuplicateParams(params); err != nil {
+		return err
+	}
+	c.Params = params
+	return nil
+}
+
+// checkDuplicateParams two params with the same name, ex. fields with the same name in the tag
+func (c *Controller) checkDuplicateParams(params []*ControllerParam) error {
+	names := map[string]bool{}
+	for _, param := range params {
+		if names[param.Name] {
+			return errorControllerParamsSchema(c.Name, "duplicate param "+param.Name)
+		}
+		names[param.Name] = true
+	}
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func paramTypeOf(t reflect.Type) (ParamType, bool) {
+	if t == timeType {
+		return ParamTime, true
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return ParamString, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ParamInt, true
+	case reflect.Float32, reflect.Float64:
+		return ParamFloat, true
+	case reflect.Bool:
+		return ParamBool, true
+	case reflect.Slice:
+		switch t.Elem().Kind() {
+		case reflect.String:
+			return ParamStringSlice, true
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return ParamIntSlice, true
+		}
+	}
+	return 0, false
+}
+
+// param gets the declaration of the param
+func (c *Controller) param(name string) *ControllerParam {
+	for _, param := range c.Params {
+		if param.Name == name {
+			return param
+		}
+	}
+	return nil
+}
+
+// compileParams checks the params of the element at compile time and parses the params informed by expression
+// (`param-user-id="{user.id}"`), evaluated when rendering
+func (c *Controller) compileParams(attrs *sht.Attributes, tag string) (map[string]*sht.Expression, error) {
+	expressions := map[string]*sht.Expression{}
+	informed := map[string]bool{}
+
+	for attrName, attr := range attrs.Map {
+		if !strings.HasPrefix(attrName, "param-") {
+			continue
+		}
+		name := strcase.ToLowerCamel(strings.Replace(attrName, "param-", "", 1))
+		informed[name] = true
+
+		param := c.param(name)
+		if c.Params != nil && param == nil {
+			return nil, errorControllerParamUnknown(c.Name, name, tag)
+		}
+
+		value := strings.TrimSpace(attr.Value)
+		if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") && strings.Count(value, "{") == 1 {
+			expression, err := sht.ParseExpression(value[1 : len(value)-1])
+			if err != nil {
+				return nil, errorControllerParamExpression(c.Name, name, err.Error(), tag)
+			}
+			expressions[name] = expression
+			continue
+		}
+
+		if param == nil {
+			continue
+		}
+		if _, err := param.coerce(attr.Value); err != nil {
+			return nil, errorControllerParamType(c.Name, name, param.Type, attr.Value, tag)
+		}
+	}
+
+	for _, param := range c.Params {
+		if param.Required && !informed[param.Name] {
+			return nil, errorControllerParamRequired(c.Name, param.Name, tag)
+		}
+	}
+
+	return expressions, nil
+}
+
+// coerceParams converts the values to the types declared by the controller, params without declaration are kept
+func (c *Controller) coerceParams(params map[string]interface{}, tag string) (map[string]interface{}, error) {
+	for _, param := range c.Params {
+		value, exists := params[param.Name]
+		if !exists {
+			if param.Required {
+				return params, errorControllerParamRequired(c.Name, param.Name, tag)
+			}
+			if param.Default != nil {
+				params[param.Name] = param.Default
+			}
+			continue
+		}
+
+		coerced, err := param.coerce(value)
+		if err != nil {
+			return params, errorControllerParamType(c.Name, param.Name, param.Type, value, tag)
+		}
+		params[param.Name] = coerced
+	}
+	return params, nil
+}
+
+// coerce converts the value (attribute, result of expression or JSON) to the type of the param
+func (p *ControllerParam) coerce(value interface{}) (interface{}, error) {
+	switch p.Type {
+	case ParamString:
+		if value == nil {
+			return "", nil
+		}
+		if text, isString := value.(string); isString {
+			return text, nil
+		}
+		return fmt.Sprintf("%v", value), nil
+	case ParamInt:
+		return coerceInt(value)
+	case ParamFloat:
+		return coerceFloat(value)
+	case ParamBool:
+		return coerceBool(value)
+	case ParamTime:
+		return coerceTime(value)
+	case ParamStringSlice:
+		items, err := coerceSlice(value)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]string, len(items))
+		for i, item := range items {
+			if text, isString := item.(string); isString {
+				out[i] = strings.TrimSpace(text)
+			} else {
+				out[i] = fmt.Sprintf("%v", item)
+			}
+		}
+		return out, nil
+	case ParamIntSlice:
+		items, err := coerceSlice(value)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]int, len(items))
+		for i, item := range items {
+			number, errItem := coerceInt(item)
+			if errItem != nil {
+				return nil, errItem
+			}
+			out[i] = number
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unknown type %d", p.Type)
+}
+
+func coerceInt(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.Atoi(strings.TrimSpace(v))
+	case float64:
+		if v != float64(int(v)) {
+			return 0, fmt.Errorf("%v is not an integer", v)
+		}
+		return int(v), nil
+	case float32:
+		return coerceInt(float64(v))
+	}
+
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(reflected.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(reflected.Uint()), nil
+	}
+	return 0, fmt.Errorf("%T is not an integer", value)
+}
+
+func coerceFloat(value interface{}) (float64, error) {
+	if text, isString := value.(string); isString {
+		return strconv.ParseFloat(strings.TrimSpace(text), 64)
+	}
+
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return reflected.Float(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(reflected.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(reflected.Uint()), nil
+	}
+	return 0, fmt.Errorf("%T is not a number", value)
+}
+
+func coerceBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "" {
+			// <div controller="x" param-active>
+			return true, nil
+		}
+		return strconv.ParseBool(v)
+	}
+	return false, fmt.Errorf("%T is not a boolean", value)
+}
+
+func coerceTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case string:
+		v = strings.TrimSpace(v)
+		if parsed, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return parsed, nil
+		}
+		return time.Parse("2006-01-02", v)
+	}
+	return time.Time{}, fmt.Errorf("%T is not a time", value)
+}
+
+func coerceSlice(value interface{}) ([]interface{}, error) {
+	if text, isString := value.(string); isString {
+		if strings.TrimSpace(text) == "" {
+			return []interface{}{}, nil
+		}
+		var items []interface{}
+		for _, item := range strings.Split(text, ",") {
+			items = append(items, item)
+		}
+		return items, nil
+	}
+
+	reflected := reflect.ValueOf(value)
+	if reflected.Kind() != reflect.Slice && reflected.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%T is not a list", value)
+	}
+	items := make([]interface{}, reflected.Len())
+	for i := range items {
+		items[i] = reflected.Index(i).Interface()
+	}
+	return items, nil
+}
@@ -0,0 +1,142 @@
+package syntax
+
+import (
+	"github.com/syntax-framework/shtml/sht"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type userCardParams struct {
+	UserID int       `param:"userId,required"`
+	Active bool      `param:"active"`
+	Tags   []string  `param:"tags"`
+	Since  time.Time `param:"since"`
+}
+
+func Test_Controller_Params_Schema(t *testing.T) {
+	s := &Syntax{liveControllers: &liveControllers{}}
+
+	var received map[string]interface{}
+	controller := &Controller{
+		Name: "user-card",
+		Setup: func(scope *sht.Scope, params map[string]interface{}) {
+			received = params
+		},
+	}
+	if err := controller.DeclareParams(userCardParams{}); err != nil {
+		t.Fatal(err)
+	}
+	s.Controllers = append(s.Controllers, controller)
+
+	directives := &sht.Directives{}
+	for _, directive := range s.CreateControllerDirectives() {
+		directives.Add(directive)
+	}
+	compile := func(template string) (*sht.Compiled, error) {
+		compiler := sht.NewCompiler(&sht.TemplateSystem{Directives: directives.NewChild()})
+		return compiler.Compile(template, "template.html")
+	}
+
+	tests := []struct {
+		template string
+		code     string
+	}{
+		{`<div controller="user-card"></div>`, "controller.param.required"},
+		{`<div controller="user-card" param-user-id="abc"></div>`, "controller.param.type"},
+		{`<div controller="user-card" param-user-id="1" param-color="red"></div>`, "controller.param.unknown"},
+		{`<div controller="user-card" param-user-id="1" param-since="yesterday"></div>`, "controller.param.type"},
+		{`<div controller="user-card" param-user-id="1" param-colour="{color}"></div>`, "controller.param.unknown"},
+	}
+	for _, tt := range tests {
+		if _, err := compile(tt.template); err == nil || !strings.Contains(err.Error(), tt.code) {
+			t.Errorf("controller.Compile | invalid error %s\n   actual: %v\n expected: %s", tt.template, err, tt.code)
+		}
+	}
+
+	compiled, err := compile(`<div controller="user-card" param-user-id="{id}" param-active param-tags="a, b" param-since="2022-09-01"><b>card</b></div>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope := sht.NewRootScope()
+	scope.Set("id", "42")
+	compiled.Exec(scope)
+
+	expected := map[string]interface{}{
+		"userId": 42,
+		"active": true,
+		"tags":   []string{"a", "b"},
+		"since":  time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("controller.Process | invalid params\n   actual: %#v\n expected: %#v", received, expected)
+	}
+
+	// the values of the expressions are checked when rendering
+	scope = sht.NewRootScope()
+	scope.Set("id", "abc")
+	received = nil
+	compiled.Exec(scope)
+	if err := controllerError(scope.Context); err == nil || !strings.Contains(err.Error(), "controller.param.type") {
+		t.Errorf("controller.Process | expected error\n   actual: %v", err)
+	}
+	if received != nil {
+		t.Errorf("controller.Process | the controller must not run with invalid params\n   actual: %#v", received)
+	}
+}
+
+func Test_Controller_Params_Duplicate(t *testing.T) {
+	controller := &Controller{Name: "user-card"}
+
+	err := controller.DeclareParams([]*ControllerParam{{Name: "id"}, {Name: "id", Type: ParamInt}})
+	if err == nil || !strings.Contains(err.Error(), "controller.params.schema") {
+		t.Errorf("Controller.DeclareParams(list) | expected error\n   actual: %v", err)
+	}
+
+	type duplicated struct {
+		ID     int    `param:"id"`
+		UserID string `param:"id"`
+	}
+	if err = controller.DeclareParams(duplicated{}); err == nil {
+		t.Errorf("Controller.DeclareParams(struct) | expected error")
+	}
+	if err = controller.DeclareParams([]*ControllerParam{{Name: "id"}, nil}); err == nil || !strings.Contains(err.Error(), "controller.params.schema") {
+		t.Errorf("Controller.DeclareParams(nil) | expected error\n   actual: %v", err)
+	}
+	if controller.Params != nil {
+		t.Errorf("Controller.DeclareParams | invalid schema must not be declared")
+	}
+}
+
+func Test_Controller_Params_Render_Error(t *testing.T) {
+	s := newTestSyntax(map[string]string{
+		"users/[id].html": `<div controller="user-card" param-user-id="{params.id}"><b>card</b></div>`,
+		"/_layout/root":   `!{content}`,
+	})
+	controller, err := s.RegisterController("user-card", func(scope *sht.Scope, params map[string]interface{}) {}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = controller.DeclareParams(userCardParams{}); err != nil {
+		t.Fatal(err)
+	}
+	s.initErrorPages()
+	if err = s.processPage("users/[id].html"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("GET", "/users/abc", nil))
+	if body := w.Body.String(); w.Code != http.StatusInternalServerError || strings.Contains(body, "<b>") {
+		t.Errorf("controller.Process | the render must fail\n   actual: %d %s", w.Code, body)
+	}
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("GET", "/users/7", nil))
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, "<b>card</b>") {
+		t.Errorf("controller.Process | invalid output\n   actual: %d %s", w.Code, body)
+	}
+}
@@ -3,13 +3,28 @@ package syntax
 import (
 	"github.com/syntax-framework/shtml/cmn"
 	"github.com/syntax-framework/shtml/sht"
-	"log"
 	"strings"
 )
 
 var errorControllerInvalidState = cmn.Err(
 	"controller.invalid.state",
 	"It is not allowed to register new controllers after initialization.", "Name: %s",
+	"Action: Register the controller before the method `syntax.Init()`",
+)
+
+var errorControllerName = cmn.Err(
+	"controller.name.invalid",
+	"The name of the controller is not valid, it must not be empty nor contain spaces.", "Name: %s",
+)
+
+var errorControllerExists = cmn.Err(
+	"controller.exists",
+	"There is already a controller registered with the same name.", "Name: %s",
+)
+
+var errorControllerEmpty = cmn.Err(
+	"controller.empty",
+	"The controller has no Setup, Live nor Hooks.", "Name: %s",
 )
 
 // se desenvolvedor precisar de dados da requisição, criar um midleware e adiconar no Context.
@@ -19,47 +34,143 @@ var errorControllerInvalidState = cmn.Err(
 //}
 
 type Controller struct {
-	Name  string
-	Setup ControllerSetupFunc
-	Live  ControllerLiveFunc
+	Name   string
+	Setup  ControllerSetupFunc
+	Live   ControllerLiveFunc
+	Params []*ControllerParam // when declared, the params are checked and converted, see DeclareParams
+	Hooks  *ControllerHooks
 }
 
-type LiveState struct {
+// isLive checks if the controller keeps running on the server after the render
+func (c *Controller) isLive() bool {
+	return c.Live != nil || (c.Hooks != nil && (c.Hooks.HandleEvent != nil || c.Hooks.HandleInfo != nil))
 }
 
-// On p
-func (l LiveState) On(event string, callback func(params map[string]interface{})) {
+// LiveState the live part of a controller. The handlers registered are executed when the client sends the event, after
+// that the element of the controller is rendered again and the client receives the changes.
+type LiveState struct {
+	handlers map[string]func(params map[string]interface{})
+}
 
+// On registers the handler of an event sent by the client (ex. `<button stx-click="increment">`)
+func (l *LiveState) On(event string, callback func(params map[string]interface{})) {
+	if l.handlers == nil {
+		l.handlers = map[string]func(params map[string]interface{}){}
+	}
+	l.handlers[event] = callback
 }
 
 type ControllerSetupFunc func(scope *sht.Scope, params map[string]interface{})
 
 type ControllerLiveFunc func(scope *sht.Scope, params map[string]interface{}, live *LiveState)
 
-func (s *Syntax) RegisterController(name string, setup ControllerSetupFunc, live ControllerLiveFunc) {
+// RegisterController registers a controller. In development (Config.Dev), controllers can be registered after
+// `syntax.Init()`, replacing the controller with the same name and recompiling the pages that use it.
+func (s *Syntax) RegisterController(name string, setup ControllerSetupFunc, live ControllerLiveFunc) (*Controller, error) {
+	return s.addController(&Controller{
+		Name:  strings.TrimSpace(name),
+		Setup: setup,
+		Live:  live,
+	})
+}
+
+// RegisterControllerHooks registers a controller defined by its lifecycle hooks. The controller is live when it
+// handles events or PubSub messages.
+func (s *Syntax) RegisterControllerHooks(name string, hooks *ControllerHooks) (*Controller, error) {
+	return s.addController(&Controller{
+		Name:  strings.TrimSpace(name),
+		Hooks: hooks,
+	})
+}
 
-	if s.initialized {
-		failToStart(
-			errorControllerInvalidState(name).Error(),
-			"Change the controller record to run before the method `syntax.Init()`",
-		)
+func (s *Syntax) addController(controller *Controller) (*Controller, error) {
+	if err := validateController(controller); err != nil {
+		return nil, err
 	}
 
-	name = strings.TrimSpace(name)
-	if name == "" || strings.ContainsRune(name, ' ') {
-		log.Fatal("Nome de controller inválido " + name)
+	replace := false
+	if s.isInitialized() {
+		if !s.Config.Dev {
+			return nil, errorControllerInvalidState(controller.Name)
+		}
+		// development, hot swap
+		replace = true
+	}
+
+	s.controllersMutex.Lock()
+	replaced := false
+	for i, existing := range s.Controllers {
+		if existing.Name == controller.Name {
+			if !replace {
+				s.controllersMutex.Unlock()
+				return nil, errorControllerExists(controller.Name)
+			}
+			s.Controllers[i] = controller
+			replaced = true
+		}
+	}
+	if !replaced {
+		s.Controllers = append(s.Controllers, controller)
 	}
+	s.controllersMutex.Unlock()
+
+	if replace {
+		s.recompileControllerPages(controller.Name)
+	}
+	return controller, nil
+}
+
+// getController obtains a registered controller by name
+func (s *Syntax) getController(name string) *Controller {
+	s.controllersMutex.RLock()
+	defer s.controllersMutex.RUnlock()
 
 	for _, controller := range s.Controllers {
 		if controller.Name == name {
-			log.Fatal("Já existe uma controller com o nome " + name)
+			return controller
 		}
 	}
+	return nil
+}
 
-	controller := &Controller{
-		Name:  name,
-		Setup: setup,
-		Live:  live,
+// ValidateControllers checks all registered controllers, including those added directly in `Syntax.Controllers`.
+// Returns all problems found, without interrupting the application.
+func (s *Syntax) ValidateControllers() []error {
+	s.controllersMutex.RLock()
+	defer s.controllersMutex.RUnlock()
+
+	var errs []error
+	names := map[string]bool{}
+	for _, controller := range s.Controllers {
+		if err := validateController(controller); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if names[controller.Name] {
+			errs = append(errs, errorControllerExists(controller.Name))
+		}
+		names[controller.Name] = true
+	}
+	return errs
+}
+
+func validateController(controller *Controller) error {
+	if controller.Name == "" || strings.ContainsAny(controller.Name, " \t\n\"'{}<>") {
+		return errorControllerName(controller.Name)
+	}
+	if controller.Setup == nil && controller.Live == nil && controller.Hooks == nil {
+		return errorControllerEmpty(controller.Name)
+	}
+
+	params := map[string]bool{}
+	for _, param := range controller.Params {
+		if param == nil || strings.TrimSpace(param.Name) == "" {
+			return errorControllerParamsSchema(controller.Name, "param without name")
+		}
+		if params[param.Name] {
+			return errorControllerParamsSchema(controller.Name, "duplicated param "+param.Name)
+		}
+		params[param.Name] = true
 	}
-	s.Controllers = append(s.Controllers, controller)
+	return nil
 }
@@ -0,0 +1,142 @@
+package syntax
+
+import (
+	"github.com/syntax-framework/shtml/sht"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_Register_Controller(t *testing.T) {
+	s := &Syntax{Config: &Config{}}
+
+	setup := func(scope *sht.Scope, params map[string]interface{}) {
+		scope.Set("version", "v1")
+	}
+
+	if _, err := s.RegisterController("my controller", setup, nil); err == nil || !strings.Contains(err.Error(), "controller.name.invalid") {
+		t.Errorf("Syntax.RegisterController(name) | expected invalid name\n   actual: %v", err)
+	}
+	if _, err := s.RegisterController("empty", nil, nil); err == nil || !strings.Contains(err.Error(), "controller.empty") {
+		t.Errorf("Syntax.RegisterController(name) | expected empty controller\n   actual: %v", err)
+	}
+	if _, err := s.RegisterController("version", setup, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RegisterController("version", setup, nil); err == nil || !strings.Contains(err.Error(), "controller.exists") {
+		t.Errorf("Syntax.RegisterController(name) | expected duplicated controller\n   actual: %v", err)
+	}
+
+	s.Controllers = append(s.Controllers, &Controller{Name: "version"})
+	if errs := s.ValidateControllers(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "controller.empty") {
+		t.Errorf("Syntax.ValidateControllers() | invalid errors\n   actual: %v", errs)
+	}
+	s.Controllers = s.Controllers[:1]
+
+	s.initialized = true
+	if _, err := s.RegisterController("other", setup, nil); err == nil || !strings.Contains(err.Error(), "controller.invalid.state") {
+		t.Errorf("Syntax.RegisterController(name) | expected invalid state\n   actual: %v", err)
+	}
+}
+
+func Test_Register_Controller_Dev_Replace(t *testing.T) {
+	s := &Syntax{Config: &Config{Dev: true}, Bundler: &Bundler{}, liveControllers: &liveControllers{}}
+
+	files := map[string]string{
+		"index.html":    `<div controller="version"><b>{version}</b></div>`,
+		"/_layout/root": `{content}`,
+	}
+	system := &sht.TemplateSystem{
+		Loader: func(filepath string) (string, error) {
+			return files[filepath], nil
+		},
+		Directives: &sht.Directives{},
+	}
+	s.Template = system
+	system.Register(s.CreateControllerDirectives()...)
+
+	if _, err := s.RegisterController("version", func(scope *sht.Scope, params map[string]interface{}) {
+		scope.Set("version", "v1")
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	page := &pageRoute{file: "index.html", path: "/"}
+	if err := s.compilePage(page); err != nil {
+		t.Fatal(err)
+	}
+	s.pageRoutes = map[string]*pageRoute{page.file: page}
+	s.initialized = true
+
+	if _, err := s.RegisterController("version", func(scope *sht.Scope, params map[string]interface{}) {
+		scope.Set("version", "v2")
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.Controllers) != 1 {
+		t.Errorf("Syntax.RegisterController(name) | the controller must be replaced\n   actual: %d controllers", len(s.Controllers))
+	}
+	if html := page.compiled.Exec(sht.NewRootScope()).String(); !strings.Contains(html, "<b>v2</b>") {
+		t.Errorf("Syntax.RegisterController(name) | the page must be recompiled\n   actual: %s", html)
+	}
+}
+
+func Test_Init_Failed(t *testing.T) {
+	s := newTestSyntax(nil)
+	s.Register(&Model{Name: "user"})
+
+	if err := s.Init(); err == nil || !strings.Contains(err.Error(), "model.invalid") {
+		t.Fatalf("Syntax.Init() | expected invalid model\n   actual: %v", err)
+	}
+	if s.initialized {
+		t.Errorf("Syntax.Init() | a failed Init must not mark the application as initialized")
+	}
+	if _, err := s.RegisterController("version", func(scope *sht.Scope, params map[string]interface{}) {}, nil); err != nil {
+		t.Errorf("Syntax.RegisterController(name) | controllers can be registered after a failed Init\n   actual: %v", err)
+	}
+}
+
+func Test_Init_Retry(t *testing.T) {
+	s := newTestSyntax(map[string]string{
+		"about.html":         `<b>about</b>`,
+		"index.html":         `<model name="user" /><b>{user}</b>`,
+		"/_layout/root.html": `!{content}`,
+		"/_layout/root":      `!{content}`,
+	})
+	s.AddFileSystemEmbed(syntaxDefaultFiles, "static/", -1)
+	s.pubsub = &PubSub{}
+	s.channels = map[string]*Channel{}
+	s.sseReplay = newSSEReplay(0, 0)
+
+	// fails after the live server and the first page were initialized
+	if err := s.Init(); err == nil || !strings.Contains(err.Error(), "model.notfound") {
+		t.Fatalf("Syntax.Init() | expected model not found\n   actual: %v", err)
+	}
+
+	s.Register(&Model{Name: "user", Load: func(req *ModelRequest) (*ModelResult, error) {
+		return &ModelResult{Data: "Alex"}, nil
+	}})
+	if err := s.Init(); err != nil {
+		t.Fatalf("Syntax.Init() | a failed Init can be called again\n   actual: %v", err)
+	}
+
+	routes := map[string]int{}
+	for _, route := range s.routes {
+		routes[route.method+" "+route.path]++
+	}
+	for _, route := range []string{"GET /live", "POST /live", "GET /about.html", "GET /"} {
+		if routes[route] != 1 {
+			t.Errorf("Syntax.Init() | the route must be registered once\n   actual: %s %d", route, routes[route])
+		}
+	}
+	if middlewares := len(s.middlewares); middlewares > 1 {
+		t.Errorf("Syntax.Init() | the session must be registered once\n   actual: %d", middlewares)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if body := w.Body.String(); body != "<b>Alex</b>" {
+		t.Errorf("Syntax.Init() | invalid output\n   actual: %s", body)
+	}
+}
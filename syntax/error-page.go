@@ -0,0 +1,211 @@
+package syntax
+
+import (
+	"errors"
+	"fmt"
+	"github.com/syntax-framework/chain"
+	"io/fs"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// errorPagesDir directory of the error pages, `_error/404.html`, `_error/5xx.html`
+const errorPagesDir = "/_error/"
+
+// ErrorPage the error being rendered, available to the error pages as `{error.Status}`. The Error and the Stack are
+// only informed in development (Config.Dev).
+type ErrorPage struct {
+	Status int
+	Title  string // http.StatusText
+	Path   string // path of the request
+	Error  string
+	Stack  string
+}
+
+// pagePanic a panic recovered outside the goroutine of the request (ex. in the loader of a model), keeps the stack
+// of where it happened
+type pagePanic struct {
+	value interface{}
+	stack []byte
+}
+
+func (p *pagePanic) String() string {
+	return fmt.Sprint(p.value)
+}
+
+// initErrorPages renders the error pages when the route does not exist, the handler fails or panics
+func (s *Syntax) initErrorPages() {
+	s.router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.renderError(w, r, http.StatusNotFound, nil, nil)
+	})
+
+	s.router.ErrorHandler = func(ctx *chain.Context, err error) {
+		if responseSent(ctx.Writer) {
+			log.Printf("[syntax] error serving %s after the response was sent. %s", ctx.Request.URL.Path, err)
+			return
+		}
+		s.renderError(ctx.Writer, ctx.Request, http.StatusInternalServerError, err, nil)
+	}
+
+	s.router.PanicHandler = func(w http.ResponseWriter, r *http.Request, rcv interface{}) {
+		stack := debug.Stack()
+		if recovered, isPagePanic := rcv.(*pagePanic); isPagePanic {
+			rcv, stack = recovered.value, recovered.stack
+		}
+		err, isError := rcv.(error)
+		if !isError {
+			err = fmt.Errorf("%v", rcv)
+		}
+		log.Printf("[syntax] panic serving %s. %s\n%s", r.URL.Path, err, stack)
+		if responseSent(w) {
+			// the error page would be appended to the content already sent
+			return
+		}
+		s.renderError(w, r, http.StatusInternalServerError, err, stack)
+	}
+}
+
+// responseSent checks if the headers of the response were already sent (see chain.ResponseWriterSpy)
+func responseSent(w http.ResponseWriter) bool {
+	ctx := &chain.Context{Writer: w}
+	return ctx.RegisterBeforeSend(func() {}) == chain.AlreadySentError
+}
+
+// errorPageFiles the templates that can render the status, in order of priority. Ex. for 503 are `_error/503.html`,
+// `_error/5xx.html` and `_error/500.html`
+func errorPageFiles(status int) []string {
+	files := []string{
+		errorPagesDir + strconv.Itoa(status) + ".html",
+		errorPagesDir + strconv.Itoa(status/100) + "xx.html",
+	}
+	if status > http.StatusInternalServerError {
+		files = append(files, errorPagesDir+"500.html")
+	}
+	return files
+}
+
+// getErrorPage obtains the compiled error page of the status, nil when the application does not have one. The pages
+// are compiled only once, in development they are compiled again after the files change (see
+// Syntax.invalidateErrorPages). A page that fails to compile keeps the error, shown in development. Outside
+// development the failure is logged once and the status is rendered in plain text.
+func (s *Syntax) getErrorPage(status int) *pageRoute {
+	s.errorPagesMutex.RLock()
+	page, exists := s.errorPages[status]
+	s.errorPagesMutex.RUnlock()
+	if exists {
+		return page
+	}
+
+	for _, file := range errorPageFiles(status) {
+		candidate := &pageRoute{file: file, path: file}
+		if err := s.compileErrorPage(candidate); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			log.Printf("[syntax] unable to compile the error page %d. %s", status, err)
+			if s.Config.Dev {
+				page = candidate
+			}
+			break
+		}
+		page = candidate
+		break
+	}
+
+	s.errorPagesMutex.Lock()
+	if s.errorPages == nil {
+		s.errorPages = map[int]*pageRoute{}
+	}
+	s.errorPages[status] = page
+	s.errorPagesMutex.Unlock()
+	return page
+}
+
+// compileErrorPage compiles the error page without routing it, the dependencies are kept apart from the pages
+// (Syntax.errorGraph). The assets are registered by the file, `/_error/*` is never the path of a route.
+func (s *Syntax) compileErrorPage(page *pageRoute) error {
+	return s.compileTemplate(page, &s.errorGraph)
+}
+
+// invalidateErrorPages discards the compiled error pages when one of the changed files is an error page or is used
+// by one of them. Used in development, the pages are compiled again on the next error.
+func (s *Syntax) invalidateErrorPages(paths []string) {
+	changed := false
+	for _, path := range paths {
+		if strings.HasPrefix(pageGraphKey(path), errorPagesDir) || len(s.errorGraph.pages(path)) > 0 {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return
+	}
+
+	s.errorPagesMutex.Lock()
+	pages := s.errorPages
+	s.errorPages = nil
+	s.errorPagesMutex.Unlock()
+
+	for _, page := range pages {
+		if page != nil {
+			s.errorGraph.delete(page.file)
+			s.Bundler.SetPageAssets(page.path, nil)
+		}
+	}
+}
+
+// renderError responds with the error page of the status, rendered with its layout. Without an error page (or when
+// the error page itself fails), responds in plain text.
+func (s *Syntax) renderError(w http.ResponseWriter, r *http.Request, status int, err error, stack []byte) {
+	info := &ErrorPage{Status: status, Title: http.StatusText(status), Path: r.URL.Path}
+	if s.Config.Dev {
+		if err != nil {
+			info.Error = err.Error()
+		}
+		info.Stack = string(stack)
+	}
+
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			log.Printf("[syntax] panic rendering the error page %d. %v\n%s", status, rcv, debug.Stack())
+			s.renderErrorText(w, info)
+		}
+	}()
+
+	page := s.getErrorPage(status)
+	if page == nil {
+		s.renderErrorText(w, info)
+		return
+	}
+
+	page.mutex.RLock()
+	compileErr := page.err
+	page.mutex.RUnlock()
+	if compileErr != nil {
+		s.renderCompileError(w, r, compileErr, page.file)
+		return
+	}
+
+	rootScope := s.Template.NewScope()
+	rootScope.Set("error", info)
+	rootScope.Set("params", map[string]string{})
+	if errWrite := s.writePage(w, page, rootScope, status); errWrite != nil {
+		log.Printf("[syntax] unable to render the error page %d. %s", status, errWrite)
+		s.renderErrorText(w, info)
+	}
+}
+
+// renderErrorText responds the error in plain text
+func (s *Syntax) renderErrorText(w http.ResponseWriter, info *ErrorPage) {
+	text := strconv.Itoa(info.Status) + " " + info.Title
+	if info.Error != "" {
+		text += "\n\n" + info.Error
+	}
+	if info.Stack != "" {
+		text += "\n\n" + info.Stack
+	}
+	http.Error(w, text, info.Status)
+}
@@ -0,0 +1,139 @@
+package syntax
+
+import (
+	"github.com/syntax-framework/chain"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_Error_Pages(t *testing.T) {
+	s := newTestSyntax(map[string]string{
+		"broken.html":        `<model name="broken" /><b>{broken}</b>`,
+		"/_error/404.html":   `<page title="Not Found"></page><h1>{error.Status} {error.Path}</h1>`,
+		"/_error/5xx.html":   `<h1>{error.Title}</h1><pre>{error.Stack}</pre>`,
+		"/_error/403.html":   `<model name="missing" /><h1>{error.Status}</h1>`,
+		"/_layout/root.html": `<main>!{content}</main>`,
+		"/_layout/root":      `<main>!{content}</main>`,
+	})
+	s.Register(&Model{Name: "broken", Load: func(req *ModelRequest) (*ModelResult, error) {
+		panic("nil map")
+	}})
+	s.initErrorPages()
+	if err := s.processPage("broken.html"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	if body := w.Body.String(); w.Code != http.StatusNotFound || body != "<main><h1>404 /missing</h1></main>" {
+		t.Errorf("Syntax.renderError(404) | invalid output\n   actual: %d %s", w.Code, body)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Errorf("Syntax.renderError(404) | invalid content type\n   actual: %s", contentType)
+	}
+
+	// error page that doesn't compile, plain text without compiling again
+	for i := 0; i < 2; i++ {
+		w = httptest.NewRecorder()
+		s.renderError(w, httptest.NewRequest("GET", "/", nil), http.StatusForbidden, nil, nil)
+		if body := w.Body.String(); w.Code != http.StatusForbidden || !strings.HasPrefix(body, "403 Forbidden") {
+			t.Errorf("Syntax.renderError(403) | invalid output\n   actual: %d %s", w.Code, body)
+		}
+	}
+	if page, exists := s.errorPages[http.StatusForbidden]; !exists || page != nil {
+		t.Errorf("Syntax.getErrorPage(403) | the failure must be cached\n   actual: %v %v", exists, page)
+	}
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("GET", "/broken.html", nil))
+	if body := w.Body.String(); w.Code != http.StatusInternalServerError || body != "<main><h1>Internal Server Error</h1><pre></pre></main>" {
+		t.Errorf("Syntax.renderError(500) | invalid output\n   actual: %d %s", w.Code, body)
+	}
+
+	// stack trace only in development
+	s.Config.Dev = true
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("GET", "/broken.html", nil))
+	if body := w.Body.String(); w.Code != http.StatusInternalServerError || !strings.Contains(body, "model.go") {
+		t.Errorf("Syntax.renderError(500) | stack trace expected\n   actual: %d %s", w.Code, body)
+	}
+
+	// without error page
+	w = httptest.NewRecorder()
+	s.renderError(w, httptest.NewRequest("GET", "/", nil), http.StatusBadRequest, nil, nil)
+	if body := w.Body.String(); w.Code != http.StatusBadRequest || !strings.HasPrefix(body, "400 Bad Request") {
+		t.Errorf("Syntax.renderError(400) | invalid output\n   actual: %d %s", w.Code, body)
+	}
+}
+
+func Test_Error_Pages_Dev(t *testing.T) {
+	s := newTestSyntax(map[string]string{
+		"/_error/404.html":   `<h1>{error.Status}</h1>`,
+		"/_layout/root.html": `!{content}`,
+		"/_layout/root":      `!{content}`,
+	})
+	s.Config.Dev = true
+	s.initErrorPages()
+	fsys := s.FileSystems[0].fs.(fstest.MapFS)
+
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	if code, body := get("/missing"); code != http.StatusNotFound || body != "<h1>404</h1>" {
+		t.Errorf("Syntax.renderError(404) | invalid output\n   actual: %d %s", code, body)
+	}
+	if pages := s.pageGraph.pages("/_error/404.html"); len(pages) != 0 {
+		t.Errorf("Syntax.getErrorPage(404) | the error page is not a page\n   actual: %v", pages)
+	}
+	if s.routes != nil || s.pageRoutes != nil {
+		t.Errorf("Syntax.getErrorPage(404) | the error page must not be routed\n   actual: %v %v", s.routes, s.pageRoutes)
+	}
+
+	// cached until the file changes
+	fsys["_error/404.html"] = &fstest.MapFile{Data: []byte(`<h2>{error.Status}</h2>`)}
+	s.forgetFile("/_error/404.html")
+	if _, body := get("/missing"); body != "<h1>404</h1>" {
+		t.Errorf("Syntax.getErrorPage(404) | the error page must be cached\n   actual: %s", body)
+	}
+	s.reloadFiles([]string{"/_error/404.html"})
+	if _, body := get("/missing"); body != "<h2>404</h2>" {
+		t.Errorf("Syntax.reloadFiles(error page) | the error page must be compiled again\n   actual: %s", body)
+	}
+
+	// compile error shown in the browser, until fixed
+	fsys["_error/404.html"] = &fstest.MapFile{Data: []byte(`<model name="missing" /><h1>{error.Status}</h1>`)}
+	s.reloadFiles([]string{"/_error/404.html"})
+	if code, body := get("/missing"); code != http.StatusInternalServerError || !strings.Contains(body, "model.notfound") {
+		t.Errorf("Syntax.renderError(404) | the compile error must be shown\n   actual: %d %s", code, body)
+	}
+	fsys["_error/404.html"] = &fstest.MapFile{Data: []byte(`<h3>{error.Status}</h3>`)}
+	s.reloadFiles([]string{"/_error/404.html"})
+	if _, body := get("/missing"); body != "<h3>404</h3>" {
+		t.Errorf("Syntax.reloadFiles(error page) | the error page must be compiled again\n   actual: %s", body)
+	}
+}
+
+func Test_Error_Pages_Response_Sent(t *testing.T) {
+	s := newTestSyntax(map[string]string{
+		"/_error/5xx.html":   `<h1>{error.Title}</h1>`,
+		"/_layout/root.html": `!{content}`,
+		"/_layout/root":      `!{content}`,
+	})
+	s.initErrorPages()
+	s.router.GET("/partial", func(ctx *chain.Context) {
+		ctx.Writer.Write([]byte("<b>partial</b>"))
+		panic("failed")
+	})
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("GET", "/partial", nil))
+	if body := w.Body.String(); w.Code != http.StatusOK || body != "<b>partial</b>" {
+		t.Errorf("Router.PanicHandler() | the error page must not be rendered after the response was sent\n   actual: %d %s", w.Code, body)
+	}
+}
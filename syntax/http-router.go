@@ -3,12 +3,23 @@ package syntax
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"github.com/syntax-framework/chain"
+	"github.com/syntax-framework/shtml/cmn"
 	"github.com/syntax-framework/shtml/sht"
 	"io"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
+var errorRouteConflict = cmn.Err(
+	"router.route.conflict",
+	"The route conflicts with an existing route. Routes with the same segments can't be registered, even with different param names (ex. `/users/:id` and `/users/:name`).",
+	"Route: %s %s",
+	"Existing: %s",
+)
+
 var fallbackSessionIDSeq = &sht.Sequence{Salt: time.Now().String()}
 
 // RegenerateSessionID permite gerar um novo session ID para o usuario
@@ -35,37 +46,168 @@ func (s *Syntax) RegenerateSessionID(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Syntax) Use(args ...interface{}) {
+	s.routerMutex.Lock()
+	defer s.routerMutex.Unlock()
+	s.middlewares = append(s.middlewares, args)
 	s.router.Use(args...)
 }
 
 func (s *Syntax) GET(path string, handle interface{}) {
-	s.router.GET(path, handle)
+	s.Handle(http.MethodGet, path, handle)
 }
 
 func (s *Syntax) HEAD(path string, handle interface{}) {
-	s.router.HEAD(path, handle)
+	s.Handle(http.MethodHead, path, handle)
 }
 
 func (s *Syntax) OPTIONS(path string, handle interface{}) {
-	s.router.OPTIONS(path, handle)
+	s.Handle(http.MethodOptions, path, handle)
 }
 
 func (s *Syntax) POST(path string, handle interface{}) {
-	s.router.POST(path, handle)
+	s.Handle(http.MethodPost, path, handle)
 }
 
 func (s *Syntax) PUT(path string, handle interface{}) {
-	s.router.PUT(path, handle)
+	s.Handle(http.MethodPut, path, handle)
 }
 
 func (s *Syntax) PATCH(path string, handle interface{}) {
-	s.router.PATCH(path, handle)
+	s.Handle(http.MethodPatch, path, handle)
 }
 
 func (s *Syntax) DELETE(path string, handle interface{}) {
-	s.router.DELETE(path, handle)
+	s.Handle(http.MethodDelete, path, handle)
 }
 
+// Handle registers the route. Registering the same method and path again replaces the handle. A route that conflicts
+// with an existing one, same segments with different param names (ex. `/users/:id` and `/users/:name`), is not
+// registered and the error is logged.
 func (s *Syntax) Handle(method string, path string, handle interface{}) {
-	s.router.Handle(method, path, handle)
+	if err := s.addRoute(method, path, handle); err != nil {
+		log.Printf("[syntax] unable to register the route %s %s. %s", method, path, err)
+	}
+}
+
+// addRoute registers the route, replacing the handle of the same route. Returns an error when it conflicts with an
+// existing route
+func (s *Syntax) addRoute(method string, path string, handle interface{}) error {
+	s.routerMutex.Lock()
+	defer s.routerMutex.Unlock()
+
+	if err := s.checkRouteLocked(method, path); err != nil {
+		return err
+	}
+
+	replaced := false
+	for _, route := range s.routes {
+		if route.method == method && route.path == path {
+			route.handle = handle
+			replaced = true
+		}
+	}
+	if !replaced {
+		s.routes = append(s.routes, &routeHandle{method: method, path: path, handle: handle})
+	}
+	if s.serving || replaced {
+		// the router can't be changed while serving requests, nor replace a route
+		s.rebuildRouter()
+	} else {
+		s.router.Handle(method, path, handle)
+	}
+	return nil
+}
+
+// checkRoute checks if the route can be registered, the chain.Router panics on conflicts. The same route can be
+// registered again (see Syntax.addRoute)
+func (s *Syntax) checkRoute(method string, path string) error {
+	s.routerMutex.RLock()
+	defer s.routerMutex.RUnlock()
+	return s.checkRouteLocked(method, path)
+}
+
+func (s *Syntax) checkRouteLocked(method string, path string) error {
+	shape := routeShape(path)
+	for _, route := range s.routes {
+		if route.method == method && route.path != path && routeShape(route.path) == shape {
+			return errorRouteConflict(method, path, route.path)
+		}
+	}
+	return nil
+}
+
+// routeShape the path without the names of the params (`/users/:id` is `/users/:`)
+func routeShape(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = ":"
+		} else if strings.HasPrefix(segment, "*") {
+			segments[i] = "*"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// routeHandle a route registered in the application, allows rebuilding the router
+type routeHandle struct {
+	method string
+	path   string
+	handle interface{}
+}
+
+// removeRoute removes the route from the application, used in development when a page is removed
+func (s *Syntax) removeRoute(method string, path string) {
+	s.routerMutex.Lock()
+	defer s.routerMutex.Unlock()
+
+	var routes []*routeHandle
+	for _, route := range s.routes {
+		if route.method != method || route.path != path {
+			routes = append(routes, route)
+		}
+	}
+	s.routes = routes
+	s.rebuildRouter()
+}
+
+// rebuildRouter replaces the router with a new one, with the same settings, middlewares and routes. The chain.Router
+// doesn't allow changing or removing routes, requests in progress continue on the previous router.
+func (s *Syntax) rebuildRouter() {
+	previous := s.router
+	router := chain.New()
+	router.Crypto = previous.Crypto
+	router.SecretKeyBase = previous.SecretKeyBase
+	router.RedirectTrailingSlash = previous.RedirectTrailingSlash
+	router.RedirectFixedPath = previous.RedirectFixedPath
+	router.HandleOPTIONS = previous.HandleOPTIONS
+	router.HandleMethodNotAllowed = previous.HandleMethodNotAllowed
+	router.NotFoundHandler = previous.NotFoundHandler
+	router.MethodNotAllowedHandler = previous.MethodNotAllowedHandler
+	router.GlobalOPTIONSHandler = previous.GlobalOPTIONSHandler
+	router.ErrorHandler = previous.ErrorHandler
+	router.PanicHandler = previous.PanicHandler
+	for _, args := range s.middlewares {
+		var replay []interface{}
+		for _, arg := range args {
+			if handler, isInit := arg.(chain.MiddlewareWithInitHandler); isInit {
+				// already initialized (ex. the keys of the session.Manager are derived on Init)
+				arg = handler.Handle
+			}
+			replay = append(replay, arg)
+		}
+		router.Use(replay...)
+	}
+	for _, route := range s.routes {
+		router.Handle(route.method, route.path, route.handle)
+	}
+	s.router = router
+}
+
+// ServeHTTP implements http.Handler
+func (s *Syntax) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.routerMutex.RLock()
+	router := s.router
+	s.routerMutex.RUnlock()
+	router.ServeHTTP(w, r)
 }
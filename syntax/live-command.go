@@ -0,0 +1,199 @@
+package syntax
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/syntax-framework/chain"
+	"github.com/syntax-framework/shtml/cmn"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// eventConnection event sent to the client as soon as it connects, informs the id of the connection
+const eventConnection = "stx_connection"
+
+// eventJoin event sent by the client to join a topic
+const eventJoin = "stx_join"
+
+// eventLeave event sent by the client to leave a topic
+const eventLeave = "stx_leave"
+
+// eventReply event sent to the client with the response of a command
+const eventReply = "stx_reply"
+
+// liveCommandMaxSize max size of the body of a command sent by the client
+const liveCommandMaxSize = 1 << 20
+
+var errorLiveCommandInvalid = cmn.Err(
+	"live.command.invalid",
+	"The command sent by the client is not valid.", "Cause: %s",
+)
+
+var errorLiveConnectionNotFound = cmn.Err(
+	"live.connection.notfound",
+	"There is no live connection with the given id, the client must reconnect.", "Id: %s",
+)
+
+var errorLiveCommandForbidden = cmn.Err(
+	"live.command.forbidden",
+	"The command was not sent by the client of the live connection.", "Id: %s",
+)
+
+var errorLiveCommandContentType = cmn.Err(
+	"live.command.contenttype",
+	"The command must be sent as application/json.", "Content-Type: %s",
+)
+
+var errorChannelEventNotFound = cmn.Err(
+	"pubsub.channel.event.notfound",
+	"There is no handler registered for the event.", "Channel: %s", "Event: %s",
+)
+
+// liveCommand envelope of the messages sent by the client to the live endpoint
+type liveCommand struct {
+	Socket  string                 `json:"socket"` // id of the client connection
+	Token   string                 `json:"token"`  // secret of the client connection, required by POST
+	Channel string                 `json:"channel"`
+	Topic   string                 `json:"topic"`
+	Event   string                 `json:"event"`
+	Payload map[string]interface{} `json:"payload"`
+	Ref     string                 `json:"ref"` // used by the client to correlate the reply
+}
+
+// liveReply payload of the reply sent to the client
+type liveReply struct {
+	Status   string      `json:"status"` // "ok" | "error"
+	Response interface{} `json:"response,omitempty"`
+	Reason   string      `json:"reason,omitempty"`
+}
+
+// handleLiveCommand receives a command from the client, the result of the command is sent back to the client
+// through its live connection. Only the client that owns the connection knows its token, informed by the server on the
+// connection itself.
+func (s *Syntax) handleLiveCommand(ctx *chain.Context) {
+	w, r := ctx.Writer, ctx.Request
+
+	// json is not a simple request, browsers don't send it cross-site without CORS authorization
+	contentType := r.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/json" {
+		http.Error(w, errorLiveCommandContentType(contentType).Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if _, err := requestOrigin(r); err != nil {
+		http.Error(w, errorLiveCommandForbidden(r.Header.Get("Origin")).Error(), http.StatusForbidden)
+		return
+	}
+
+	command := &liveCommand{}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, liveCommandMaxSize))
+	if err := decoder.Decode(command); err != nil {
+		http.Error(w, errorLiveCommandInvalid(err.Error()).Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := command.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conn := s.sseHub.get(command.Socket)
+	if conn == nil {
+		http.Error(w, errorLiveConnectionNotFound(command.Socket).Error(), http.StatusGone)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(command.Token), []byte(conn.token)) != 1 {
+		http.Error(w, errorLiveCommandForbidden(command.Socket).Error(), http.StatusForbidden)
+		return
+	}
+
+	channel, err := s.getChannel(command.Channel)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+
+	s.execLiveCommand(conn, channel, command)
+}
+
+// validate normalizes the command and checks the required fields
+func (c *liveCommand) validate() error {
+	c.Channel = strings.TrimSpace(c.Channel)
+	c.Topic = strings.TrimSpace(c.Topic)
+	c.Event = strings.TrimSpace(c.Event)
+	if c.Channel == "" || c.Topic == "" || c.Event == "" {
+		return errorLiveCommandInvalid("channel, topic and event are required")
+	}
+	return nil
+}
+
+// execLiveCommand runs a command received from the client, independent of the transport (POST or WebSocket)
+func (s *Syntax) execLiveCommand(conn *SSESubscription, channel *Channel, command *liveCommand) {
+	socket := conn.socket(channel)
+
+	var reply interface{}
+	var err error
+	switch command.Event {
+	case eventJoin:
+		err = channel.requestJoin(command.Topic, command.Payload, socket)
+	case eventLeave:
+		channel.requestLeave(command.Topic, socket)
+	default:
+		if socket.Joined(command.Topic) {
+			reply, err = channel.handle(command.Topic, command.Event, command.Payload, socket)
+		} else {
+			err = errorTopicNotJoined(channel.name, command.Topic)
+		}
+	}
+	socket.reply(command.Topic, command.Ref, reply, err)
+}
+
+// replyError sends the error of a command that could not be run to the client, used when the command does not reach
+// a Channel
+func (c *SSESubscription) replyError(command *liveCommand, err error) {
+	if command.Ref == "" {
+		// client is not waiting for a response
+		log.Printf("[syntax] %s", err)
+		return
+	}
+
+	event, errEncode := encodeMessage(&Message{
+		Channel: command.Channel,
+		Topic:   command.Topic,
+		Event:   eventReply,
+		Payload: &liveReply{Status: "error", Reason: err.Error()},
+		Ref:     command.Ref,
+	})
+	if errEncode != nil {
+		log.Printf("[syntax] %s", errEncode)
+		return
+	}
+	c.send(event)
+}
+
+// reply sends the response of a command to the client
+func (s *Socket) reply(topic string, ref string, response interface{}, err error) {
+	if ref == "" {
+		// client is not waiting for a response
+		if err != nil {
+			log.Printf("[syntax] %s", err)
+		}
+		return
+	}
+
+	payload := &liveReply{Status: "ok", Response: response}
+	if err != nil {
+		payload = &liveReply{Status: "error", Reason: err.Error()}
+	}
+
+	s.deliver(&Message{
+		Channel: s.Channel.name,
+		Topic:   topic,
+		Event:   eventReply,
+		Payload: payload,
+		Ref:     ref,
+	})
+}
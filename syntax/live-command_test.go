@@ -0,0 +1,118 @@
+package syntax
+
+import (
+	"encoding/json"
+	"github.com/syntax-framework/chain"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Live_Command(t *testing.T) {
+	s := &Syntax{
+		pubsub:    &PubSub{},
+		channels:  map[string]*Channel{},
+		sseReplay: newSSEReplay(0, 0),
+		sseHub:    newSSEHub(),
+		router:    chain.New(),
+	}
+	go s.sseHub.run()
+	s.POST("/live", s.handleLiveCommand)
+
+	channel, _ := s.Channel("room")
+	channel.OnJoin("*", func(topic string, params map[string]interface{}, socket *Socket) error {
+		return nil
+	})
+	channel.On("ping", func(topic string, params map[string]interface{}, socket *Socket) (interface{}, error) {
+		return "pong", nil
+	})
+
+	conn := s.sseHub.subscribe(httptest.NewRequest("GET", "/live", nil), 0)
+	defer conn.close()
+	<-conn.event // stx_connection
+
+	post := func(body string, contentType string, origin string) int {
+		r := httptest.NewRequest("POST", "http://example.com/live", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	command := func(event string, token string) string {
+		data, _ := json.Marshal(&liveCommand{
+			Socket: conn.ID, Token: token, Channel: "room", Topic: "lobby", Event: event, Ref: event,
+		})
+		return string(data)
+	}
+
+	receive := func(ref string) *liveReply {
+		select {
+		case event := <-conn.event:
+			reply := &liveReply{}
+			message := &Message{Payload: reply}
+			if err := json.Unmarshal(event.Data, message); err != nil {
+				t.Fatal(err)
+			}
+			if message.Event != eventReply || message.Ref != ref {
+				t.Fatalf("Syntax.handleLiveCommand | invalid reply\n   actual: %+v", message)
+			}
+			return reply
+		case <-time.After(time.Second):
+			t.Fatalf("Syntax.handleLiveCommand | timeout waiting the reply %s", ref)
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		origin      string
+		status      int
+	}{
+		{"text/plain", command("ping", conn.token), "text/plain", "", http.StatusUnsupportedMediaType},
+		{"malformed body", `{"socket":`, "application/json", "", http.StatusBadRequest},
+		{"missing fields", `{"socket":"` + conn.ID + `"}`, "application/json", "", http.StatusBadRequest},
+		{"unknown socket", `{"socket":"x","channel":"room","topic":"lobby","event":"ping"}`, "application/json", "", http.StatusGone},
+		{"without token", command("ping", ""), "application/json", "", http.StatusForbidden},
+		{"invalid token", command("ping", conn.ID), "application/json", "", http.StatusForbidden},
+		{"cross-site", command("ping", conn.token), "application/json", "http://evil.com", http.StatusForbidden},
+		{"unknown channel", strings.Replace(command("ping", conn.token), `"room"`, `"other"`, 1), "application/json", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if status := post(tt.body, tt.contentType, tt.origin); status != tt.status {
+			t.Errorf("Syntax.handleLiveCommand(%s) | invalid status\n   actual: %d\n expected: %d", tt.name, status, tt.status)
+		}
+	}
+	select {
+	case event := <-conn.event:
+		t.Errorf("Syntax.handleLiveCommand | refused commands must not be executed\n   actual: %s", event.Data)
+	default:
+	}
+
+	// not joined
+	if status := post(command("ping", conn.token), "application/json; charset=utf-8", ""); status != http.StatusAccepted {
+		t.Fatalf("Syntax.handleLiveCommand | invalid status\n   actual: %d\n expected: 202", status)
+	}
+	if reply := receive("ping"); reply.Status != "error" || !strings.Contains(reply.Reason, "pubsub.topic.notjoined") {
+		t.Errorf("Syntax.handleLiveCommand | expected error reply\n   actual: %+v", reply)
+	}
+
+	if status := post(command(eventJoin, conn.token), "application/json", "http://example.com"); status != http.StatusAccepted {
+		t.Fatalf("Syntax.handleLiveCommand | invalid status\n   actual: %d\n expected: 202", status)
+	}
+	if reply := receive(eventJoin); reply.Status != "ok" {
+		t.Errorf("Syntax.handleLiveCommand(join) | invalid reply\n   actual: %+v", reply)
+	}
+
+	post(command("ping", conn.token), "application/json", "")
+	if reply := receive("ping"); reply.Status != "ok" || reply.Response != "pong" {
+		t.Errorf("Syntax.handleLiveCommand(ping) | invalid reply\n   actual: %+v\n expected: pong", reply)
+	}
+}
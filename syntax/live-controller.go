@@ -0,0 +1,444 @@
+package syntax
+
+import (
+	"github.com/syntax-framework/shtml/cmn"
+	"github.com/syntax-framework/shtml/sht"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// liveChannelName channel used by the clients to connect to the live controllers, the topic is the instance id
+const liveChannelName = "stx_live"
+
+// liveEventRender event with the full render of a live controller, sent when the client joins
+const liveEventRender = "render"
+
+// liveEventDiff event with the changes in the render of a live controller
+const liveEventDiff = "diff"
+
+// liveEventClient event sent by the client with the DOM events, payload `{event, params}`
+const liveEventClient = "event"
+
+// liveControllerMountTimeout time that a rendered live controller waits for the client to connect
+const liveControllerMountTimeout = time.Minute
+
+var errorLiveControllerNotFound = cmn.Err(
+	"controller.live.notfound",
+	"There is no live controller instance with the given id, the page must be reloaded.", "Id: %s",
+)
+
+var errorLiveControllerMounted = cmn.Err(
+	"controller.live.mounted",
+	"The live controller instance is already connected to another client.", "Id: %s",
+)
+
+var errorLiveEventNotFound = cmn.Err(
+	"controller.live.event.notfound",
+	"The live controller has no handler for the event.", "Controller: %s", "Event: %s",
+)
+
+// liveController an instance of a live controller, one per element rendered. Keeps the scope of the element in memory
+// while the client is connected, each event received re-renders the element and the client receives only the diff.
+type liveController struct {
+	id         string
+	controller *Controller
+	params     map[string]interface{}
+	mutex      sync.Mutex
+	scope      *sht.Scope
+	state      *LiveState
+	render     func() *sht.Rendered // re-renders the element subtree using the instance scope
+	rendered   *sht.Rendered        // last render sent to the client
+	socket     *Socket
+	context    *ControllerContext
+	created    time.Time
+}
+
+// liveControllers instances of live controllers waiting for a client or connected
+type liveControllers struct {
+	mutex     sync.Mutex
+	instances map[string]*liveController
+	templates map[string]*liveTemplate // by key, the hash of the source
+}
+
+// liveTemplate source of an element with a live controller, compiled again to rebuild the controller when the client
+// reconnects
+type liveTemplate struct {
+	source   string
+	mutex    sync.Mutex
+	compiled *sht.Compiled
+}
+
+// liveRebuild informs the controller directive that the element is being rendered again to rebuild an instance
+type liveRebuild struct {
+	id         string
+	controller string
+	params     map[string]interface{}
+	request    *http.Request // request of the live connection
+	instance   *liveController
+}
+
+// liveRebuildKey key of the liveRebuild in the sht.Context
+const liveRebuildKey = "stx_live_rebuild"
+
+// register keeps the source of an element with a live controller, returns the key of the template
+func (l *liveControllers) register(source string) string {
+	key := sht.HashXXH64Hex(source)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.templates == nil {
+		l.templates = map[string]*liveTemplate{}
+	}
+	if _, exists := l.templates[key]; !exists {
+		l.templates[key] = &liveTemplate{source: source}
+	}
+	return key
+}
+
+// create registers a new instance, instances that were never mounted by a client are discarded
+func (l *liveControllers) create(id string, controller *Controller, params map[string]interface{}) *liveController {
+	if id == "" {
+		id = newSubscriptionID()
+	}
+	now := time.Now()
+	instance := &liveController{
+		id:         id,
+		controller: controller,
+		params:     params,
+		state:      &LiveState{handlers: map[string]func(params map[string]interface{}){}},
+		created:    now,
+	}
+
+	l.mutex.Lock()
+
+	if l.instances == nil {
+		l.instances = map[string]*liveController{}
+	}
+	var expired []*liveController
+	for id, other := range l.instances {
+		if other.socket == nil && now.Sub(other.created) > liveControllerMountTimeout {
+			delete(l.instances, id)
+			expired = append(expired, other)
+		}
+	}
+	l.instances[instance.id] = instance
+	l.mutex.Unlock()
+
+	for _, other := range expired {
+		other.terminate()
+	}
+	return instance
+}
+
+// mount binds the instance to the socket of the client
+func (l *liveControllers) mount(id string, socket *Socket) (*liveController, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	instance, exists := l.instances[id]
+	if !exists {
+		return nil, errorLiveControllerNotFound(id)
+	}
+	if instance.socket != nil && instance.socket != socket {
+		return nil, errorLiveControllerMounted(id)
+	}
+	instance.socket = socket
+	if instance.context != nil {
+		instance.context.Request = socket.Request()
+	}
+	return instance, nil
+}
+
+func (l *liveControllers) get(id string) *liveController {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.instances[id]
+}
+
+// mounted obtains the instance bound to the socket, nil when the instance doesn't exist or is bound to another socket
+func (l *liveControllers) mounted(id string, socket *Socket) *liveController {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if instance := l.instances[id]; instance != nil && instance.socket == socket {
+		return instance
+	}
+	return nil
+}
+
+// leave discards the instance bound to the socket, the instance remounted by another socket is kept
+func (l *liveControllers) leave(id string, socket *Socket) {
+	l.mutex.Lock()
+	instance := l.instances[id]
+	if instance == nil || instance.socket != socket {
+		l.mutex.Unlock()
+		return
+	}
+	delete(l.instances, id)
+	l.mutex.Unlock()
+
+	instance.terminate()
+}
+
+// remove discards the instance, terminating the controller
+func (l *liveControllers) remove(id string) {
+	l.mutex.Lock()
+	instance := l.instances[id]
+	delete(l.instances, id)
+	l.mutex.Unlock()
+
+	if instance != nil {
+		instance.terminate()
+	}
+}
+
+// rebuild renders again the element of a live controller from the params sent back by the client. Used when the
+// instance no longer exists, for example, after the server restarts or the client reconnects late.
+func (s *Syntax) rebuildLiveController(id string, token string, r *http.Request) (*liveController, error) {
+	if s.controllerParams == nil {
+		return nil, errorSecretKeyBaseEmpty()
+	}
+
+	decoded, err := s.controllerParams.decode(token)
+	if err != nil {
+		return nil, err
+	}
+
+	s.liveControllers.mutex.Lock()
+	template := s.liveControllers.templates[decoded.Template]
+	s.liveControllers.mutex.Unlock()
+	if template == nil {
+		return nil, errorLiveControllerNotFound(id)
+	}
+
+	template.mutex.Lock()
+	if template.compiled == nil {
+		compiler := sht.NewCompiler(s.Template.(*sht.TemplateSystem))
+		if template.compiled, err = compiler.Compile(template.source, decoded.Template+".html"); err != nil {
+			template.mutex.Unlock()
+			return nil, err
+		}
+	}
+	compiled := template.compiled
+	template.mutex.Unlock()
+
+	rebuild := &liveRebuild{id: id, controller: decoded.Controller, params: decoded.Params, request: r}
+	scope := sht.NewRootScope()
+	scope.Context.Set(liveRebuildKey, rebuild)
+	if decoded.Route != nil {
+		scope.Context.Set(RouteParamsKey, decoded.Route)
+		scope.Set("params", decoded.Route)
+	}
+	compiled.Exec(scope)
+	if err = controllerError(scope.Context); err != nil {
+		return nil, err
+	}
+	if rebuild.instance == nil {
+		return nil, errorLiveControllerNotFound(id)
+	}
+	return rebuild.instance, nil
+}
+
+// setup runs the controller on the scope of the element
+func (c *liveController) setup(scope *sht.Scope) {
+	c.scope = scope
+	c.context.Scope = scope
+	if c.controller.Setup != nil {
+		c.controller.Setup(scope, c.params)
+	}
+	c.context.mount()
+	if c.controller.Live != nil {
+		c.controller.Live(scope, c.params, c.state)
+	}
+}
+
+// handle runs the handler of the event (LiveState or ControllerHooks.HandleEvent) and sends the diff of the new
+// render to the client
+func (c *liveController) handle(event string, params map[string]interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	if callback, exists := c.state.handlers[event]; exists {
+		callback(params)
+	} else if c.controller.Hooks != nil && c.controller.Hooks.HandleEvent != nil {
+		if err := c.controller.Hooks.HandleEvent(c.context, event, params); err != nil {
+			return err
+		}
+	} else {
+		return errorLiveEventNotFound(c.controller.Name, event)
+	}
+
+	c.update()
+	return nil
+}
+
+// info runs the HandleInfo hook with a message of a topic subscribed by the controller
+func (c *liveController) info(topic string, content interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.controller.Hooks == nil || c.controller.Hooks.HandleInfo == nil || c.render == nil {
+		return
+	}
+	c.controller.Hooks.HandleInfo(c.context, topic, content)
+	c.update()
+}
+
+// terminate ends the controller, when the client disconnects or never connects
+func (c *liveController) terminate() {
+	if c.context != nil {
+		c.context.terminate()
+	}
+}
+
+// update renders the element again and sends the diff to the client
+func (c *liveController) update() {
+	rendered := c.render()
+	diff := diffRendered(c.rendered, rendered)
+	c.rendered = rendered
+	if len(diff) > 0 && c.socket != nil {
+		c.socket.Push(c.id, liveEventDiff, diff)
+	}
+}
+
+// initLiveControllers registers the channel used by the clients to connect to the live controllers
+func (s *Syntax) initLiveControllers() error {
+	channel, err := s.Channel(liveChannelName)
+	if err != nil {
+		return err
+	}
+
+	if err = channel.OnJoin("*", func(topic string, params map[string]interface{}, socket *Socket) error {
+		if s.liveControllers.get(topic) == nil {
+			// reconnection, the client sends back the signed params
+			token, _ := params["par"].(string)
+			if token == "" {
+				return errorLiveControllerNotFound(topic)
+			}
+			if _, errRebuild := s.rebuildLiveController(topic, token, socket.Request()); errRebuild != nil {
+				return errRebuild
+			}
+		}
+
+		instance, errMount := s.liveControllers.mount(topic, socket)
+		if errMount != nil {
+			return errMount
+		}
+
+		instance.mutex.Lock()
+		defer instance.mutex.Unlock()
+		socket.Push(topic, liveEventRender, encodeRendered(instance.rendered))
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	channel.OnLeave(func(topic string, socket *Socket) {
+		s.liveControllers.leave(topic, socket)
+	})
+
+	return channel.On(liveEventClient, func(topic string, params map[string]interface{}, socket *Socket) (interface{}, error) {
+		instance := s.liveControllers.mounted(topic, socket)
+		if instance == nil {
+			return nil, errorLiveControllerNotFound(topic)
+		}
+
+		event, _ := params["event"].(string)
+		eventParams, _ := params["params"].(map[string]interface{})
+		if err := instance.handle(event, eventParams); err != nil {
+			log.Printf("[syntax] %s", err)
+			return nil, err
+		}
+		return nil, nil
+	})
+}
+
+// encodeRendered serializes the full render to the client, `{"s": static, "0": dynamic, "1": dynamic, ...}`
+func encodeRendered(rendered *sht.Rendered) map[string]interface{} {
+	out := map[string]interface{}{}
+	if rendered == nil {
+		out["s"] = []string{""}
+		return out
+	}
+	if rendered.Static == nil {
+		out["s"] = []string{""}
+	} else {
+		out["s"] = *rendered.Static
+	}
+	for i, dynamic := range rendered.Dynamics {
+		out[strconv.Itoa(i)] = encodeDynamic(dynamic)
+	}
+	return out
+}
+
+func encodeDynamic(dynamic interface{}) interface{} {
+	if value, ok := dynamic.(string); ok {
+		return value
+	} else if rendered, ok := dynamic.(*sht.Rendered); ok && rendered != nil {
+		return encodeRendered(rendered)
+	}
+	return ""
+}
+
+// diffRendered computes the dynamic parts that changed between two renders. When the static part of a render
+// changes, the full render is sent, otherwise only the changed dynamics, recursively.
+func diffRendered(old *sht.Rendered, rendered *sht.Rendered) map[string]interface{} {
+	if old == nil || rendered == nil || !sameStatic(old, rendered) || len(old.Dynamics) != len(rendered.Dynamics) {
+		return encodeRendered(rendered)
+	}
+
+	diff := map[string]interface{}{}
+	for i, dynamic := range rendered.Dynamics {
+		key := strconv.Itoa(i)
+		previous := old.Dynamics[i]
+
+		dynamicRendered, isRendered := dynamic.(*sht.Rendered)
+		previousRendered, wasRendered := previous.(*sht.Rendered)
+		if isRendered && dynamicRendered != nil {
+			if wasRendered && previousRendered != nil {
+				if changes := diffRendered(previousRendered, dynamicRendered); len(changes) > 0 {
+					diff[key] = changes
+				}
+			} else {
+				diff[key] = encodeRendered(dynamicRendered)
+			}
+			continue
+		}
+
+		value, _ := dynamic.(string)
+		previousValue, _ := previous.(string)
+		if value != previousValue || (wasRendered && previousRendered != nil) {
+			diff[key] = value
+		}
+	}
+	return diff
+}
+
+// sameStatic checks if both renders have the same static part
+func sameStatic(a *sht.Rendered, b *sht.Rendered) bool {
+	if a.Static == b.Static {
+		return true
+	}
+	if a.Static == nil || b.Static == nil {
+		return false
+	}
+	if a.Fingerprint != "" && a.Fingerprint == b.Fingerprint {
+		return true
+	}
+	staticA, staticB := *a.Static, *b.Static
+	if len(staticA) != len(staticB) {
+		return false
+	}
+	for i := range staticA {
+		if staticA[i] != staticB[i] {
+			return false
+		}
+	}
+	return true
+}
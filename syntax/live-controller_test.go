@@ -0,0 +1,314 @@
+package syntax
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/syntax-framework/shtml/sht"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Live_Controller(t *testing.T) {
+	s := &Syntax{pubsub: &PubSub{}, channels: map[string]*Channel{}, sseReplay: newSSEReplay(0, 0), liveControllers: &liveControllers{}}
+
+	s.Controllers = append(s.Controllers, &Controller{
+		Name: "counter",
+		Setup: func(scope *sht.Scope, params map[string]interface{}) {
+			scope.Set("count", 0)
+		},
+		Live: func(scope *sht.Scope, params map[string]interface{}, live *LiveState) {
+			live.On("increment", func(params map[string]interface{}) {
+				count, _ := scope.Get("count")
+				scope.Set("count", count.(int)+1)
+			})
+		},
+	})
+
+	directives := &sht.Directives{}
+	for _, directive := range s.CreateControllerDirectives() {
+		directives.Add(directive)
+	}
+	compiler := sht.NewCompiler(&sht.TemplateSystem{Directives: directives.NewChild()})
+	compiled, err := compiler.Compile(`<div controller="counter"><b>{title}</b><span>{count}</span></div>`, "template.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scope := sht.NewRootScope()
+	scope.Set("title", "Counter")
+	html := compiled.Exec(scope).String()
+	if !strings.Contains(html, "<b>Counter</b><span>0</span>") || !strings.Contains(html, `data-stx-live="`) {
+		t.Fatalf("controller.Process | invalid output\n   actual: %s", html)
+	}
+
+	if err = s.initLiveControllers(); err != nil {
+		t.Fatal(err)
+	}
+	channel, _ := s.getChannel(liveChannelName)
+
+	var id string
+	for instanceID := range s.liveControllers.instances {
+		id = instanceID
+	}
+
+	conn := &testSocketConn{events: make(chan *SSEEvent, 10)}
+	socket := &Socket{Channel: channel, conn: conn}
+	if err = channel.requestJoin(id, nil, socket); err != nil {
+		t.Fatal(err)
+	}
+
+	receive := func(event string) map[string]interface{} {
+		select {
+		case sse := <-conn.events:
+			message := &Message{}
+			if err := json.Unmarshal(sse.Data, message); err != nil {
+				t.Fatal(err)
+			}
+			if message.Event != event {
+				t.Fatalf("liveController | invalid event\n   actual: %s\n expected: %s", message.Event, event)
+			}
+			return message.Payload.(map[string]interface{})
+		case <-time.After(time.Second):
+			t.Fatalf("liveController | timeout waiting %s", event)
+		}
+		return nil
+	}
+
+	receive(liveEventRender)
+
+	if _, err = channel.handle(id, liveEventClient, map[string]interface{}{"event": "increment"}, socket); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the content changed, the diff must not carry static parts nor the unchanged title
+	diff, _ := json.Marshal(receive(liveEventDiff))
+	if strings.Contains(string(diff), `"s"`) || strings.Contains(string(diff), "Counter") || !strings.Contains(string(diff), `"1"`) {
+		t.Errorf("liveController.handle(event) | invalid diff\n   actual: %s", diff)
+	}
+
+	channel.requestLeave(id, socket)
+	if s.liveControllers.get(id) != nil {
+		t.Errorf("Channel.requestLeave(topic) | instance must be removed")
+	}
+}
+
+func Test_Live_Controller_Rebuild(t *testing.T) {
+	s := &Syntax{
+		Config:          &Config{SecretKeyBase: strings.Repeat("secret", 11)},
+		pubsub:          &PubSub{},
+		channels:        map[string]*Channel{},
+		sseReplay:       newSSEReplay(0, 0),
+		liveControllers: &liveControllers{},
+	}
+	s.Controllers = append(s.Controllers, &Controller{
+		Name: "greeting",
+		Live: func(scope *sht.Scope, params map[string]interface{}, live *LiveState) {
+			scope.Set("name", params["name"])
+		},
+	})
+	s.controllerParams = newControllerParamsCodec(s.Config.SecretKeyBase, s.Config.Controller)
+
+	directives := &sht.Directives{}
+	for _, directive := range s.CreateControllerDirectives() {
+		directives.Add(directive)
+	}
+	system := &sht.TemplateSystem{Directives: directives}
+	s.Template = system
+
+	compiled, err := sht.NewCompiler(system).Compile(`<p controller="greeting" param-name="World">Hello {name}</p>`, "template.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := compiled.Exec(sht.NewRootScope()).String()
+	if !strings.Contains(html, "Hello World") {
+		t.Fatalf("controller.Process | invalid output\n   actual: %s", html)
+	}
+
+	token := html[strings.Index(html, `data-stx-ctrl-par="`)+19:]
+	token = token[:strings.IndexByte(token, '"')]
+
+	// tampered params
+	if _, err = s.rebuildLiveController("abc", token[:len(token)-2]+"xx", nil); err == nil || !strings.Contains(err.Error(), "controller.params.invalid") {
+		t.Errorf("Syntax.rebuildLiveController(id, token) | expected invalid params\n   actual: %v", err)
+	}
+
+	// expired params
+	expired := newControllerParamsCodec(s.Config.SecretKeyBase, s.Config.Controller)
+	expired.maxAge = -time.Second
+	expiredToken, _ := expired.encode("greeting", "", nil, nil)
+	if _, err = s.rebuildLiveController("abc", expiredToken, nil); err == nil || !strings.Contains(err.Error(), "controller.params.expired") {
+		t.Errorf("Syntax.rebuildLiveController(id, token) | expected expired params\n   actual: %v", err)
+	}
+
+	// server lost the instance (ex. restart), the client reconnects with the signed params
+	s.liveControllers.instances = nil
+	instance, err := s.rebuildLiveController("abc", token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instance.id != "abc" || instance.params["name"] != "World" || !strings.Contains(instance.rendered.String(), "Hello World") {
+		t.Errorf("Syntax.rebuildLiveController(id, token) | invalid instance\n   actual: %s %v", instance.id, instance.params)
+	}
+
+	// the signed params are no longer valid for the controller (ex. new deploy)
+	s.liveControllers.instances = nil
+	s.Controllers[0].DeclareParams([]*ControllerParam{{Name: "name", Type: ParamInt}})
+	if _, err = s.rebuildLiveController("abc", token, nil); err == nil || !strings.Contains(err.Error(), "controller.param.type") {
+		t.Errorf("Syntax.rebuildLiveController(id, token) | expected invalid param\n   actual: %v", err)
+	}
+}
+
+func Test_Live_Controller_Hooks(t *testing.T) {
+	s := &Syntax{pubsub: &PubSub{}, channels: map[string]*Channel{}, sseReplay: newSSEReplay(0, 0), liveControllers: &liveControllers{}}
+
+	terminated := make(chan bool, 1)
+	s.Controllers = append(s.Controllers, &Controller{
+		Name: "feed",
+		Hooks: &ControllerHooks{
+			Mount: func(ctx *ControllerContext) error {
+				ctx.Scope.Set("last", "none")
+				return ctx.Subscribe("feed:news")
+			},
+			HandleInfo: func(ctx *ControllerContext, topic string, content interface{}) {
+				ctx.Scope.Set("last", content)
+			},
+			Terminate: func(ctx *ControllerContext) {
+				terminated <- true
+			},
+		},
+	})
+
+	directives := &sht.Directives{}
+	for _, directive := range s.CreateControllerDirectives() {
+		directives.Add(directive)
+	}
+	compiler := sht.NewCompiler(&sht.TemplateSystem{Directives: directives.NewChild()})
+	compiled, err := compiler.Compile(`<div controller="feed"><span>{last}</span></div>`, "template.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html := compiled.Exec(sht.NewRootScope()).String(); !strings.Contains(html, "<span>none</span>") {
+		t.Fatalf("controller.Process | invalid output\n   actual: %s", html)
+	}
+
+	if err = s.initLiveControllers(); err != nil {
+		t.Fatal(err)
+	}
+	channel, _ := s.getChannel(liveChannelName)
+
+	var id string
+	for instanceID := range s.liveControllers.instances {
+		id = instanceID
+	}
+	conn := &testSocketConn{events: make(chan *SSEEvent, 10)}
+	socket := &Socket{Channel: channel, conn: conn}
+	if err = channel.requestJoin(id, nil, socket); err != nil {
+		t.Fatal(err)
+	}
+	<-conn.events // render
+
+	if err = s.Publish("feed:news", "breaking"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-conn.events:
+		if !strings.Contains(string(event.Data), "breaking") {
+			t.Errorf("ControllerHooks.HandleInfo | invalid diff\n   actual: %s", event.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ControllerHooks.HandleInfo | timeout waiting diff")
+	}
+
+	channel.requestLeave(id, socket)
+	select {
+	case <-terminated:
+	case <-time.After(time.Second):
+		t.Fatal("ControllerHooks.Terminate | not called")
+	}
+	if topics := s.pubsub.(*PubSub).Topics(); len(topics) != 0 {
+		t.Errorf("ControllerHooks.Terminate | subscriptions must be removed\n   actual: %v", topics)
+	}
+}
+
+func Test_Init_Live_Server_Error(t *testing.T) {
+	s := newTestSyntax(nil)
+	s.AddFileSystemEmbed(syntaxDefaultFiles, "static/", -1)
+	s.pubsub = &PubSub{}
+	s.channels = map[string]*Channel{}
+	s.sseReplay = newSSEReplay(0, 0)
+
+	// the name is reserved to the live controllers
+	if _, err := s.Channel(liveChannelName); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Init(); err == nil || !strings.Contains(err.Error(), "pubsub.channel.exists") {
+		t.Errorf("Syntax.Init() | expected error of the live server\n   actual: %v", err)
+	}
+}
+
+func Test_Controller_Mount_Error(t *testing.T) {
+	s := newTestSyntax(map[string]string{
+		"static.html":   `<div controller="static"><b>static</b></div>`,
+		"live.html":     `<div controller="live"><b>live</b></div>`,
+		"/_layout/root": `!{content}`,
+	})
+	mount := func(ctx *ControllerContext) error {
+		return errors.New("database offline")
+	}
+	if _, err := s.RegisterControllerHooks("static", &ControllerHooks{Mount: mount}); err != nil {
+		t.Fatal(err)
+	}
+	handleInfo := func(ctx *ControllerContext, topic string, content interface{}) {}
+	if _, err := s.RegisterControllerHooks("live", &ControllerHooks{Mount: mount, HandleInfo: handleInfo}); err != nil {
+		t.Fatal(err)
+	}
+	s.initErrorPages()
+
+	for _, file := range []string{"static.html", "live.html"} {
+		if err := s.processPage(file); err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest("GET", "/"+file, nil))
+		if body := w.Body.String(); w.Code != http.StatusInternalServerError || strings.Contains(body, "<b>") {
+			t.Errorf("ControllerHooks.Mount | the render must fail\n   actual: %d %s", w.Code, body)
+		}
+	}
+	if instances := len(s.liveControllers.instances); instances != 0 {
+		t.Errorf("ControllerHooks.Mount | the failed live controller must be removed\n   actual: %d", instances)
+	}
+}
+
+func Test_Live_Controller_Leave(t *testing.T) {
+	controllers := &liveControllers{}
+	instance := controllers.create("", &Controller{Name: "counter"}, nil)
+	socket := &Socket{}
+	other := &Socket{}
+
+	// the client events and the leave run concurrently with the mount
+	done := make(chan bool)
+	go func() {
+		controllers.mounted(instance.id, socket)
+		controllers.leave(instance.id, other)
+		done <- true
+	}()
+	if _, err := controllers.mount(instance.id, socket); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	if controllers.mounted(instance.id, other) != nil || controllers.mounted(instance.id, socket) != instance {
+		t.Errorf("liveControllers.mounted(id, socket) | the instance is bound to the socket that mounted it")
+	}
+	controllers.leave(instance.id, other)
+	if controllers.get(instance.id) == nil {
+		t.Errorf("liveControllers.leave(id, socket) | the instance of another socket must be kept")
+	}
+	controllers.leave(instance.id, socket)
+	if controllers.get(instance.id) != nil {
+		t.Errorf("liveControllers.leave(id, socket) | the instance must be removed")
+	}
+}
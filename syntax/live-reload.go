@@ -1,9 +1,20 @@
 package syntax
 
 import (
+	"encoding/json"
+	"github.com/syntax-framework/chain"
+	"github.com/syntax-framework/shtml/cmn"
 	"github.com/syntax-framework/shtml/sht"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // https://github.com/cortesi/devd
@@ -12,22 +23,112 @@ import (
 // https://github.com/rollup/rollup/tree/master/src/watch
 // https://github.com/fsnotify/fsnotify
 
+var errorLiveReloadPattern = cmn.Err(
+	"livereload.pattern",
+	"The live reload pattern is not a valid regular expression.", "Pattern: %s", "Cause: %s",
+)
+
+// liveReloadPollInterval interval between the scans of the directories
+const liveReloadPollInterval = 250 * time.Millisecond
+
 type liveReloadClient struct {
 	addr   string
 	events chan *liveReloadEvent
 }
 
+// liveReloadEvent sent to the browser. Type is the reload strategy, "css" when only stylesheets were changed,
+// "page" otherwise
 type liveReloadEvent struct {
-	EventType uint
+	Type   string             `json:"type"`
+	Paths  []string           `json:"paths"`
+	Assets []*liveReloadAsset `json:"assets,omitempty"` // stylesheets rebuilt, replaced in place by the client
+}
+
+// liveReloadAsset a stylesheet that changed, the client replaces the `<link data-asset="previous">` (see
+// Bundler.GetStyles). The name changes when the stylesheet is part of a bundle
+type liveReloadAsset struct {
+	Name      string `json:"name"`
+	Previous  string `json:"previous"`
+	Href      string `json:"href"`
+	Integrity string `json:"integrity,omitempty"`
+}
+
+// liveReloadFile state of a file in the last scan
+type liveReloadFile struct {
+	modTime time.Time
+	size    int64
+}
+
+// liveReload watches the directories of the site (see AddFileSystemDir) and notifies the browsers when files
+// matching the Pattern change
+type liveReload struct {
+	dirs     []string
+	patterns []*regexp.Regexp
+	debounce time.Duration
+	interval time.Duration
+	files    map[string]liveReloadFile
+	mutex    sync.RWMutex
+	clients  map[*liveReloadClient]bool
+	stop     chan struct{}
+	changed  func(event *liveReloadEvent) // invoked before notifying the browsers
 }
 
-// liveReloadInit initialize the site's live-reload client integration
+func newLiveReload(config ConfigLiveReload, dirs []string) (*liveReload, error) {
+	patterns := config.Pattern
+	if len(patterns) == 0 {
+		patterns = configLiveReloadPattern
+	}
+
+	l := &liveReload{
+		dirs:     dirs,
+		debounce: time.Duration(config.Debounce) * time.Millisecond,
+		interval: liveReloadPollInterval,
+		clients:  map[*liveReloadClient]bool{},
+		stop:     make(chan struct{}),
+	}
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errorLiveReloadPattern(pattern, err.Error())
+		}
+		l.patterns = append(l.patterns, regex)
+	}
+	return l, nil
+}
+
+// liveReloadInit initialize the site's live-reload client integration. The watcher starts at the end of Init
 func (s *Syntax) liveReloadInit(config ConfigLiveReload) error {
 
 	endpoint := strings.TrimSpace(config.Endpoint)
 	if endpoint == "" {
 		endpoint = "/dev.livereload"
 	}
+	if !strings.HasPrefix(endpoint, "/") {
+		endpoint = "/" + endpoint
+	}
+
+	interval := config.Interval
+	if interval <= 0 {
+		interval = 100
+	}
+
+	var dirs []string
+	for _, system := range s.FileSystems {
+		if system.dir != "" {
+			dirs = append(dirs, system.dir)
+		}
+	}
+
+	watcher, err := newLiveReload(config, dirs)
+	if err != nil {
+		return err
+	}
+	s.liveReload = watcher
+
+	if config.Disabled {
+		// the files are still watched, changed pages are compiled again
+		return nil
+	}
 
 	// add live-reload.js asset, required on all pages
 	asset, err := s.Template.(*sht.TemplateSystem).RegisterAssetJsFilepath("/assets/js/stx-livereload.js")
@@ -37,7 +138,7 @@ func (s *Syntax) liveReloadInit(config ConfigLiveReload) error {
 	s.Bundler.AddRequiredAsset(asset)
 
 	asset.Attributes = map[string]string{
-		"data-interval": strconv.Itoa(config.Interval),
+		"data-interval": strconv.Itoa(interval),
 		"data-endpoint": endpoint,
 	}
 	if config.ReloadCss {
@@ -46,39 +147,215 @@ func (s *Syntax) liveReloadInit(config ConfigLiveReload) error {
 		asset.Attributes["data-reload-page-on-css"] = "false"
 	}
 
-	//s.Router.GET(endpoint, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	//	// We need to be able to flush for SSE
-	//	flusher, ok := w.(http.Flusher)
-	//	if !ok {
-	//		http.Error(w, "Connection does not support streaming", http.StatusBadRequest)
-	//		return
-	//	}
-	//
-	//	client := &liveReloadClient{
-	//		addr:   r.RemoteAddr,
-	//		events: make(chan *liveReloadEvent, 10),
-	//	}
-	//	go updateClient(client)
-	//
-	//	w.Header().Set("Access-Control-Allow-Origin", "*")
-	//	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-	//	w.Header().Set("Content-Type", "text/event-stream")
-	//	w.Header().Set("Cache-Control", "no-cache")
-	//	w.Header().Set("Connection", "keep-alive")
-	//
-	//	// test
-	//	timeout := time.After(5 * time.Second)
-	//
-	//	select {
-	//	case ev := <-client.events:
-	//		var buf bytes.Buffer
-	//		enc := json.NewEncoder(&buf)
-	//		enc.Encode(ev)
-	//		fmt.Fprintf(w, "data: %v\n\n", buf.String())
-	//		flusher.Flush()
-	//	case <-timeout:
-	//		fmt.Fprintf(w, ": nothing to sent\n\n")
-	//	}
-	//})
+	s.GET(endpoint, watcher.serve)
 	return nil
 }
+
+// serve sends the live reload events to the browser (SSE)
+func (l *liveReload) serve(ctx *chain.Context) {
+	w, r := ctx.Writer, ctx.Request
+
+	// We need to be able to flush for SSE
+	flusher, ok := w.(http.Flusher)
+	if spy, isSpy := w.(*chain.ResponseWriterSpy); isSpy {
+		flusher, ok = spy.ResponseWriter.(http.Flusher)
+	}
+	if !ok {
+		http.Error(w, "Connection does not support streaming", http.StatusBadRequest)
+		return
+	}
+
+	client := l.subscribe(r.RemoteAddr)
+	defer l.unsubscribe(client)
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := newSSEEncoder(w)
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event := <-client.events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("[syntax] invalid live reload event. %s", err)
+				continue
+			}
+			if err = encoder.Encode(&SSEEvent{Data: data}); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if err := encoder.KeepAlive(); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-l.stop:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (l *liveReload) subscribe(addr string) *liveReloadClient {
+	client := &liveReloadClient{addr: addr, events: make(chan *liveReloadEvent, 10)}
+	l.mutex.Lock()
+	l.clients[client] = true
+	l.mutex.Unlock()
+	return client
+}
+
+func (l *liveReload) unsubscribe(client *liveReloadClient) {
+	l.mutex.Lock()
+	delete(l.clients, client)
+	l.mutex.Unlock()
+}
+
+// newEvent the event of the changed files
+func (l *liveReload) newEvent(paths []string) *liveReloadEvent {
+	sort.Strings(paths)
+	event := &liveReloadEvent{Type: "css", Paths: paths}
+	for _, path := range paths {
+		if !strings.HasSuffix(path, ".css") {
+			event.Type = "page"
+			break
+		}
+	}
+	return event
+}
+
+// publish notifies the browsers about the changed files
+func (l *liveReload) publish(event *liveReloadEvent) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	for client := range l.clients {
+		select {
+		case client.events <- event:
+		default:
+			log.Printf("[syntax] live reload client %s is not consuming events, event discarded", client.addr)
+		}
+	}
+}
+
+// process invokes the changed callback. A panic while processing the files doesn't stop the watcher, the next
+// change is processed again.
+func (l *liveReload) process(event *liveReloadEvent) {
+	if l.changed == nil {
+		return
+	}
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			log.Printf("[syntax] unable to process the changed files %v. %v", event.Paths, rcv)
+		}
+	}()
+	l.changed(event)
+}
+
+// close stops watching and disconnects the browsers
+func (l *liveReload) close() {
+	close(l.stop)
+}
+
+// watch scans the directories periodically. Changes are accumulated until no file changes for Debounce millis.
+func (l *liveReload) watch() {
+	l.files = l.scan()
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	pending := map[string]bool{}
+	var debounce <-chan time.Time
+	flush := func() {
+		var paths []string
+		for path := range pending {
+			paths = append(paths, path)
+		}
+		pending = map[string]bool{}
+		event := l.newEvent(paths)
+		l.process(event)
+		l.publish(event)
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			files := l.scan()
+			changed := l.changes(l.files, files)
+			l.files = files
+			if len(changed) == 0 {
+				continue
+			}
+			for _, path := range changed {
+				pending[path] = true
+			}
+			if l.debounce <= 0 {
+				flush()
+			} else {
+				debounce = time.After(l.debounce)
+			}
+		case <-debounce:
+			debounce = nil
+			flush()
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// scan the state of the files in the directories, by path relative to the directory (ex. `/assets/css/site.css`)
+func (l *liveReload) scan() map[string]liveReloadFile {
+	files := map[string]liveReloadFile{}
+	for _, dir := range l.dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return nil
+			}
+			files["/"+filepath.ToSlash(rel)] = liveReloadFile{modTime: info.ModTime(), size: info.Size()}
+			return nil
+		})
+	}
+	return files
+}
+
+// changes the paths created, modified or removed that match the patterns
+func (l *liveReload) changes(previous map[string]liveReloadFile, current map[string]liveReloadFile) []string {
+	var changed []string
+	for path, file := range current {
+		if old, exists := previous[path]; !exists || old != file {
+			if l.match(path) {
+				changed = append(changed, path)
+			}
+		}
+	}
+	for path := range previous {
+		if _, exists := current[path]; !exists && l.match(path) {
+			changed = append(changed, path)
+		}
+	}
+	return changed
+}
+
+func (l *liveReload) match(path string) bool {
+	for _, pattern := range l.patterns {
+		if pattern.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package syntax
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_Live_Reload_Watch(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "assets", "css"), 0755)
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("a"), 0644)
+
+	watcher, err := newLiveReload(ConfigLiveReload{Debounce: 100}, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher.interval = 10 * time.Millisecond
+	client := watcher.subscribe("test")
+	processed := 0
+	watcher.changed = func(event *liveReloadEvent) {
+		processed++
+		// the watcher must keep running
+		panic("changed")
+	}
+	go watcher.watch()
+	defer watcher.close()
+	time.Sleep(30 * time.Millisecond)
+
+	// burst of changes, a single event
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("ab"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0644)
+	time.Sleep(30 * time.Millisecond)
+	os.WriteFile(filepath.Join(dir, "assets", "css", "site.css"), []byte("b{}"), 0644)
+
+	select {
+	case event := <-client.events:
+		expected := &liveReloadEvent{Type: "page", Paths: []string{"/assets/css/site.css", "/index.html"}}
+		if !reflect.DeepEqual(event, expected) {
+			t.Errorf("liveReload.watch() | invalid event\n   actual: %+v\n expected: %+v", event, expected)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("liveReload.watch() | event expected")
+	}
+
+	select {
+	case event := <-client.events:
+		t.Errorf("liveReload.watch() | the changes must be debounced\n   actual: %+v", event)
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	os.WriteFile(filepath.Join(dir, "assets", "css", "site.css"), []byte("b{color:red}"), 0644)
+	select {
+	case event := <-client.events:
+		if event.Type != "css" {
+			t.Errorf("liveReload.watch() | invalid event type\n   actual: %s\n expected: css", event.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("liveReload.watch() | event expected")
+	}
+
+	if processed != 2 {
+		t.Errorf("liveReload.watch() | the changes must be processed\n   actual: %d\n expected: 2", processed)
+	}
+
+	if _, err := newLiveReload(ConfigLiveReload{Pattern: []string{"("}}, nil); err == nil {
+		t.Errorf("newLiveReload(config) | invalid pattern error expected")
+	}
+}
@@ -0,0 +1,133 @@
+package syntax
+
+import (
+	"encoding/json"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// liveFrame an event sent to the client through the WebSocket, same fields of the SSE event
+type liveFrame struct {
+	ID    string `json:"id,omitempty"`
+	Event string `json:"event,omitempty"`
+	Data  string `json:"data"`
+}
+
+// isWebSocketUpgrade checks if the client is asking to use the WebSocket transport
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// requestOrigin the Origin informed by the browser, nil when the request was not made by a browser. Fails when the
+// origin is another host
+func requestOrigin(r *http.Request) (*url.URL, error) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// not a browser
+		return nil, nil
+	}
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(originURL.Host, r.Host) {
+		return nil, websocket.ErrBadWebSocketOrigin
+	}
+	return originURL, nil
+}
+
+// checkWebSocketOrigin only accepts connections from the same host, browsers don't apply CORS to WebSockets
+func checkWebSocketOrigin(config *websocket.Config, r *http.Request) error {
+	originURL, err := requestOrigin(r)
+	if err != nil {
+		return err
+	}
+	if originURL != nil {
+		config.Origin = originURL
+	}
+	return nil
+}
+
+// serveLiveWebSocket live connection using WebSocket. The server sends the same events sent by SSE and the client
+// sends the same commands sent by POST, using the same connection.
+func (s *Syntax) serveLiveWebSocket(w http.ResponseWriter, r *http.Request, lastEventID int, keepAliveInterval time.Duration) {
+	server := websocket.Server{
+		Handshake: checkWebSocketOrigin,
+		Handler: func(ws *websocket.Conn) {
+			ws.MaxPayloadBytes = liveCommandMaxSize
+
+			sub := s.sseHub.subscribe(r, lastEventID)
+
+			// Client submits commands, executed in the order they were sent
+			received := make(chan struct{})
+			go func() {
+				defer close(received)
+				for {
+					var data []byte
+					if err := websocket.Message.Receive(ws, &data); err != nil {
+						return
+					}
+					s.handleLiveFrame(sub, data)
+				}
+			}()
+
+			defer func() {
+				ws.Close()
+				<-received
+				sub.close()
+			}()
+
+			keepAlive := time.NewTicker(keepAliveInterval)
+			defer keepAlive.Stop()
+
+			for {
+				select {
+				case event := <-sub.event:
+					frame := &liveFrame{ID: string(event.ID), Event: string(event.Event), Data: string(event.Data)}
+					if err := websocket.JSON.Send(ws, frame); err != nil {
+						return
+					}
+				case <-keepAlive.C:
+					ws.PayloadType = websocket.PingFrame
+					_, err := ws.Write(nil)
+					ws.PayloadType = websocket.TextFrame
+					if err != nil {
+						return
+					}
+				case <-sub.removed:
+					return
+				case <-received:
+					// Received Browser Disconnection
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// handleLiveFrame runs a command received through the WebSocket. Invalid commands are answered with an error reply,
+// without a ref the client does not wait for a response and the error is only logged.
+func (s *Syntax) handleLiveFrame(conn *SSESubscription, data []byte) {
+	command := &liveCommand{}
+	if err := json.Unmarshal(data, command); err != nil {
+		conn.replyError(command, errorLiveCommandInvalid(err.Error()))
+		return
+	}
+	if err := command.validate(); err != nil {
+		conn.replyError(command, err)
+		return
+	}
+
+	channel, err := s.getChannel(command.Channel)
+	if err != nil {
+		conn.replyError(command, err)
+		return
+	}
+
+	s.execLiveCommand(conn, channel, command)
+}
@@ -0,0 +1,200 @@
+package syntax
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Live_WebSocket(t *testing.T) {
+	s := &Syntax{pubsub: &PubSub{}, channels: map[string]*Channel{}, sseReplay: newSSEReplay(0, 0), sseHub: newSSEHub()}
+	go s.sseHub.run()
+
+	channel, _ := s.Channel("room")
+	channel.OnJoin("*", func(topic string, params map[string]interface{}, socket *Socket) error {
+		return nil
+	})
+	channel.On("ping", func(topic string, params map[string]interface{}, socket *Socket) (interface{}, error) {
+		return "pong:" + params["value"].(string), nil
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWebSocketUpgrade(r) {
+			t.Errorf("isWebSocketUpgrade(r) | expected upgrade request")
+		}
+		s.serveLiveWebSocket(w, r, 0, time.Minute)
+	}))
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	receive := func(event string) *liveFrame {
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		for {
+			frame := &liveFrame{}
+			if err := websocket.JSON.Receive(ws, frame); err != nil {
+				t.Fatalf("websocket.Receive(frame) | %s, waiting %s", err, event)
+			}
+			if frame.Event == event {
+				return frame
+			}
+		}
+	}
+
+	receive(eventConnection)
+
+	send := func(command *liveCommand) *liveReply {
+		if err := websocket.JSON.Send(ws, command); err != nil {
+			t.Fatal(err)
+		}
+		message := &Message{}
+		frame := receive("room:lobby")
+		reply := &liveReply{}
+		message.Payload = reply
+		if err := json.Unmarshal([]byte(frame.Data), message); err != nil {
+			t.Fatal(err)
+		}
+		if message.Event != eventReply || message.Ref != command.Ref {
+			t.Fatalf("Syntax.serveLiveWebSocket | invalid reply\n   actual: %+v", message)
+		}
+		return reply
+	}
+
+	if reply := send(&liveCommand{Channel: "room", Topic: "lobby", Event: eventJoin, Ref: "1"}); reply.Status != "ok" {
+		t.Errorf("Syntax.serveLiveWebSocket | join failed\n   actual: %+v", reply)
+	}
+
+	reply := send(&liveCommand{Channel: "room", Topic: "lobby", Event: "ping", Payload: map[string]interface{}{"value": "x"}, Ref: "2"})
+	if reply.Status != "ok" || reply.Response != "pong:x" {
+		t.Errorf("Syntax.serveLiveWebSocket | invalid output\n   actual: %+v\n expected: pong:x", reply)
+	}
+
+	if err = s.Broadcast("room:lobby", "new_msg", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if frame := receive("room:lobby"); frame.ID == "" || !strings.Contains(frame.Data, `"new_msg"`) {
+		t.Errorf("Syntax.Broadcast(topic, event, payload) | invalid frame\n   actual: %+v", frame)
+	}
+
+	// the client waiting for the reply is informed of the failure
+	if err = websocket.JSON.Send(ws, &liveCommand{Channel: "other", Topic: "lobby", Event: "ping", Ref: "3"}); err != nil {
+		t.Fatal(err)
+	}
+	reply = &liveReply{}
+	message := &Message{Payload: reply}
+	if err = json.Unmarshal([]byte(receive("other:lobby").Data), message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Ref != "3" || reply.Status != "error" || !strings.Contains(reply.Reason, "pubsub.channel.notfound") {
+		t.Errorf("Syntax.handleLiveFrame | expected error reply\n   actual: %+v %+v", message, reply)
+	}
+}
+
+// Test_Live_SSE_Fallback client without WebSocket, receives the events by SSE and sends the commands by POST
+func Test_Live_SSE_Fallback(t *testing.T) {
+	s := newTestSyntax(nil)
+	s.AddFileSystemEmbed(syntaxDefaultFiles, "static/", -1)
+	s.pubsub = &PubSub{}
+	s.channels = map[string]*Channel{}
+	s.sseReplay = newSSEReplay(0, 0)
+
+	channel, _ := s.Channel("room")
+	channel.OnJoin("*", func(topic string, params map[string]interface{}, socket *Socket) error {
+		return nil
+	})
+	channel.On("ping", func(topic string, params map[string]interface{}, socket *Socket) (interface{}, error) {
+		return "pong:" + params["value"].(string), nil
+	})
+	if err := s.initLiveServer(); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	// reads the stream until the event, `event: name\ndata: {...}\n\n`
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	receive := func(event string) string {
+		current := ""
+		for {
+			select {
+			case line, open := <-lines:
+				if !open {
+					t.Fatalf("SSE | connection closed, waiting %s", event)
+				}
+				if strings.HasPrefix(line, "event: ") {
+					current = strings.TrimPrefix(line, "event: ")
+				} else if strings.HasPrefix(line, "data: ") && current == event {
+					return strings.TrimPrefix(line, "data: ")
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("SSE | timeout waiting %s", event)
+			}
+		}
+	}
+
+	connection := &struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+	}{}
+	if err = json.Unmarshal([]byte(receive(eventConnection)), connection); err != nil {
+		t.Fatal(err)
+	}
+
+	push := func(command *liveCommand) *liveReply {
+		command.Socket, command.Token = connection.ID, connection.Token
+		data, _ := json.Marshal(command)
+		res, errPost := http.Post(server.URL+"/live", "application/json", bytes.NewReader(data))
+		if errPost != nil {
+			t.Fatal(errPost)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusAccepted {
+			t.Fatalf("POST /live | invalid status\n   actual: %d\n expected: 202", res.StatusCode)
+		}
+
+		reply := &liveReply{}
+		message := &Message{Payload: reply}
+		if errJson := json.Unmarshal([]byte(receive(command.Channel+":"+command.Topic)), message); errJson != nil {
+			t.Fatal(errJson)
+		}
+		if message.Event != eventReply || message.Ref != command.Ref {
+			t.Fatalf("POST /live | invalid reply\n   actual: %+v", message)
+		}
+		return reply
+	}
+
+	if reply := push(&liveCommand{Channel: "room", Topic: "lobby", Event: eventJoin, Ref: "1"}); reply.Status != "ok" {
+		t.Errorf("POST /live | join failed\n   actual: %+v", reply)
+	}
+	reply := push(&liveCommand{Channel: "room", Topic: "lobby", Event: "ping", Payload: map[string]interface{}{"value": "x"}, Ref: "2"})
+	if reply.Status != "ok" || reply.Response != "pong:x" {
+		t.Errorf("POST /live | invalid output\n   actual: %+v\n expected: pong:x", reply)
+	}
+	if reply = push(&liveCommand{Channel: "room", Topic: "lobby", Event: "unknown", Ref: "3"}); reply.Status != "error" {
+		t.Errorf("POST /live | expected error reply\n   actual: %+v", reply)
+	}
+}
@@ -0,0 +1,364 @@
+package syntax
+
+import (
+	"container/list"
+	"context"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+)
+
+// modelCacheTopic topic used to invalidate the cache of models on all instances of the application
+const modelCacheTopic = "stx_model:invalidate"
+
+// ModelCache how the result of a model is cached. The same Key must always produce the same Data and the keys are
+// shared by all models, usually the key is built from the name of the model and the params of the request
+// (ex. "user:" + req.Param("id")).
+type ModelCache struct {
+	Key  string
+	TTL  time.Duration // zero means until evicted or invalidated
+	Tags []string      // allows invalidating several keys at once (ex. "users")
+}
+
+// ModelCacheStore the backend of the cache of models
+type ModelCacheStore interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, data interface{}, ttl time.Duration, tags []string)
+	Delete(key string)
+	DeleteTag(tag string)
+}
+
+// modelInvalidation message published on the modelCacheTopic
+type modelInvalidation struct {
+	Key    string `json:"key,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+	Origin string `json:"origin,omitempty"` // instance that published, already applied the invalidation
+}
+
+// UseModelCache defines the backend of the cache of models. Defaults to an in-memory LRU, see ModelCacheLRU
+func (s *Syntax) UseModelCache(store ModelCacheStore) {
+	s.modelCache = store
+}
+
+// InvalidateModel removes the result cached with the key, on all instances of the application
+func (s *Syntax) InvalidateModel(key string) error {
+	return s.invalidateModelCache(&modelInvalidation{Key: key})
+}
+
+// InvalidateModelTag removes all results cached with the tag, on all instances of the application
+func (s *Syntax) InvalidateModelTag(tag string) error {
+	return s.invalidateModelCache(&modelInvalidation{Tag: tag})
+}
+
+func (s *Syntax) invalidateModelCache(invalidation *modelInvalidation) error {
+	// a render after the invalidation never receives the removed result
+	s.applyModelInvalidation(invalidation)
+	if !s.isInitialized() || s.pubsub == nil {
+		return nil
+	}
+	// the other instances apply on the subscription, see initModelCache
+	invalidation.Origin = s.modelCacheGen.origin
+	return s.pubsub.Publish(modelCacheTopic, invalidation)
+}
+
+func (s *Syntax) applyModelInvalidation(invalidation *modelInvalidation) {
+	if s.modelCache == nil {
+		return
+	}
+
+	generations := &s.modelCacheGen
+	generations.mutex.Lock()
+	defer generations.mutex.Unlock()
+
+	if invalidation.Key != "" {
+		generations.keys[modelCacheKeyIndex(invalidation.Key)]++
+		s.modelCache.Delete(invalidation.Key)
+	}
+	if invalidation.Tag != "" {
+		generations.tags++
+		s.modelCache.DeleteTag(invalidation.Tag)
+	}
+}
+
+// modelCacheGenerations change on each invalidation. A load that was in progress during an invalidation does not
+// cache its result, which may have been loaded before the change.
+type modelCacheGenerations struct {
+	mutex  sync.Mutex
+	keys   [256]uint64 // by hash of the key, see modelCacheKeyIndex
+	tags   uint64      // any tag, the tags of the result are only known after the load
+	origin string      // id of this instance in the invalidations published
+}
+
+// modelCacheGeneration the generations of a key when its load started
+type modelCacheGeneration struct {
+	key  uint64
+	tags uint64
+}
+
+func modelCacheKeyIndex(key string) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return int(hash.Sum32() % 256)
+}
+
+// current the generation of the key
+func (g *modelCacheGenerations) current(key string) modelCacheGeneration {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return modelCacheGeneration{key: g.keys[modelCacheKeyIndex(key)], tags: g.tags}
+}
+
+// set caches the data only if the key was not invalidated since the generation
+func (g *modelCacheGenerations) set(store ModelCacheStore, generation modelCacheGeneration, key string, data interface{}, ttl time.Duration, tags []string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.keys[modelCacheKeyIndex(key)] != generation.key || g.tags != generation.tags {
+		return
+	}
+	store.Set(key, data, ttl, tags)
+}
+
+// initModelCache creates the default cache and listens for invalidations, published by this or other instances
+func (s *Syntax) initModelCache() error {
+	if s.modelCache == nil {
+		s.modelCache = NewModelCacheLRU(s.Config.ModelCacheSize)
+	}
+
+	if s.modelCacheGen.origin == "" {
+		s.modelCacheGen.origin = newSubscriptionID()
+	}
+	origin := s.modelCacheGen.origin
+
+	_, err := s.pubsub.Subscribe(modelCacheTopic, func(content interface{}) {
+		switch message := content.(type) {
+		case *modelInvalidation:
+			if message.Origin != origin {
+				s.applyModelInvalidation(message)
+			}
+		case map[string]interface{}:
+			// from other instances, through the PubSubAdapter
+			if from, _ := message["origin"].(string); from == origin {
+				return
+			}
+			key, _ := message["key"].(string)
+			tag, _ := message["tag"].(string)
+			s.applyModelInvalidation(&modelInvalidation{Key: key, Tag: tag})
+		default:
+			log.Printf("[syntax] invalid message on topic %s. %v", modelCacheTopic, content)
+		}
+	})
+	return err
+}
+
+// loadModel runs the loader of the model, or obtains its Data from the cache. Concurrent loads with the same key
+// are collapsed into a single call to the loader, with a context that is not bound to any of the requests.
+func (s *Syntax) loadModel(model *Model, req *ModelRequest) (interface{}, error) {
+	var cache *ModelCache
+	if model.Prepare != nil {
+		cache = model.Prepare(req)
+	}
+	if cache == nil || cache.Key == "" || s.modelCache == nil {
+		result, err := model.Load(req)
+		if err != nil || result == nil {
+			return nil, err
+		}
+		return result.Data, nil
+	}
+
+	key := cache.Key
+	if data, hit := s.modelCache.Get(key); hit {
+		return data, nil
+	}
+
+	return s.modelFlight.do(key, func() (interface{}, error) {
+		if data, hit := s.modelCache.Get(key); hit {
+			return data, nil
+		}
+
+		// the load is shared by the requests with the same key, it is not canceled when the request that started it
+		// ends. Each request waits only until its own deadline, see loadModels
+		shared := &ModelRequest{Request: req.Request, Params: req.Params, Context: context.Background()}
+		if s.Config.ModelTimeout > 0 {
+			var cancel context.CancelFunc
+			shared.Context, cancel = context.WithTimeout(shared.Context, time.Duration(s.Config.ModelTimeout)*time.Millisecond)
+			defer cancel()
+		}
+
+		generation := s.modelCacheGen.current(key)
+		result, err := model.Load(shared)
+		if err != nil || result == nil {
+			return nil, err
+		}
+
+		ttl, tags := cache.TTL, cache.Tags
+		if result.Cache != nil {
+			// the loader can change the expiration and tags, after knowing the data
+			if result.Cache.TTL != 0 {
+				ttl = result.Cache.TTL
+			}
+			tags = append(append([]string{}, tags...), result.Cache.Tags...)
+		}
+		s.modelCacheGen.set(s.modelCache, generation, key, result.Data, ttl, tags)
+		return result.Data, nil
+	})
+}
+
+// modelFlightCall a load in progress
+type modelFlightCall struct {
+	done chan struct{}
+	data interface{}
+	err  error
+}
+
+// modelFlight collapses concurrent loads of the same key
+type modelFlight struct {
+	mutex sync.Mutex
+	calls map[string]*modelFlightCall
+}
+
+func (f *modelFlight) do(key string, load func() (interface{}, error)) (interface{}, error) {
+	f.mutex.Lock()
+	if call, exists := f.calls[key]; exists {
+		f.mutex.Unlock()
+		<-call.done
+		return call.data, call.err
+	}
+	if f.calls == nil {
+		f.calls = map[string]*modelFlightCall{}
+	}
+	call := &modelFlightCall{done: make(chan struct{})}
+	f.calls[key] = call
+	f.mutex.Unlock()
+
+	defer func() {
+		rcv := recover()
+		if rcv != nil {
+			// the others waiting for the load receive an error, the panic continues on the caller
+			call.err = errorModelPanic(key, rcv)
+		}
+		f.mutex.Lock()
+		delete(f.calls, key)
+		f.mutex.Unlock()
+		close(call.done)
+		if rcv != nil {
+			panic(rcv)
+		}
+	}()
+
+	call.data, call.err = load()
+	return call.data, call.err
+}
+
+// modelCacheEntry an item of the ModelCacheLRU
+type modelCacheEntry struct {
+	key     string
+	data    interface{}
+	expires time.Time // zero when it doesn't expire
+	tags    []string
+}
+
+// ModelCacheLRU in-memory cache, discards the least recently used entries when full
+type ModelCacheLRU struct {
+	mutex    sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List                 // front is the most recently used
+	tags     map[string]map[string]bool // keys by tag
+}
+
+// NewModelCacheLRU creates an in-memory cache with the max number of entries. Defaults to `1000`.
+func NewModelCacheLRU(capacity int) *ModelCacheLRU {
+	if capacity <= 0 {
+		capacity = 1000
+	}
+	return &ModelCacheLRU{
+		capacity: capacity,
+		entries:  map[string]*list.Element{},
+		order:    list.New(),
+		tags:     map[string]map[string]bool{},
+	}
+}
+
+func (c *ModelCacheLRU) Get(key string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+	entry := element.Value.(*modelCacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.remove(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.data, true
+}
+
+func (c *ModelCacheLRU) Set(key string, data interface{}, ttl time.Duration, tags []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, exists := c.entries[key]; exists {
+		c.remove(element)
+	}
+
+	entry := &modelCacheEntry{key: key, data: data, tags: tags}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for _, tag := range tags {
+		if c.tags[tag] == nil {
+			c.tags[tag] = map[string]bool{}
+		}
+		c.tags[tag][key] = true
+	}
+
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *ModelCacheLRU) Delete(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, exists := c.entries[key]; exists {
+		c.remove(element)
+	}
+}
+
+func (c *ModelCacheLRU) DeleteTag(tag string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key := range c.tags[tag] {
+		if element, exists := c.entries[key]; exists {
+			c.remove(element)
+		}
+	}
+	delete(c.tags, tag)
+}
+
+// Len number of entries in the cache
+func (c *ModelCacheLRU) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+func (c *ModelCacheLRU) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*modelCacheEntry)
+	delete(c.entries, entry.key)
+	for _, tag := range entry.tags {
+		if keys := c.tags[tag]; keys != nil {
+			delete(keys, entry.key)
+			if len(keys) == 0 {
+				delete(c.tags, tag)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package syntax
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Model_Cache_LRU(t *testing.T) {
+	cache := NewModelCacheLRU(2)
+
+	cache.Set("a", 1, 0, []string{"letters"})
+	cache.Set("b", 2, 0, []string{"letters"})
+	cache.Get("a")
+	cache.Set("c", 3, 0, nil)
+
+	if _, hit := cache.Get("b"); hit {
+		t.Errorf("ModelCacheLRU.Set(key) | the least recently used must be evicted")
+	}
+	if data, hit := cache.Get("a"); !hit || data != 1 {
+		t.Errorf("ModelCacheLRU.Get(key) | invalid data\n   actual: %v", data)
+	}
+
+	cache.DeleteTag("letters")
+	if _, hit := cache.Get("a"); hit || cache.Len() != 1 {
+		t.Errorf("ModelCacheLRU.DeleteTag(tag) | entries of the tag must be removed")
+	}
+
+	cache.Set("d", 4, time.Millisecond, nil)
+	time.Sleep(5 * time.Millisecond)
+	if _, hit := cache.Get("d"); hit {
+		t.Errorf("ModelCacheLRU.Get(key) | expired entry")
+	}
+}
+
+func Test_Model_Cache(t *testing.T) {
+	s := &Syntax{Config: &Config{}, pubsub: &PubSub{}}
+	if err := s.initModelCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	var loads int32
+	release := make(chan struct{})
+	model := &Model{
+		Name: "user",
+		Prepare: func(req *ModelRequest) *ModelCache {
+			return &ModelCache{Key: "user:1", Tags: []string{"users"}}
+		},
+		Load: func(req *ModelRequest) (*ModelResult, error) {
+			atomic.AddInt32(&loads, 1)
+			<-release
+			return &ModelResult{Data: "Alex"}, nil
+		},
+	}
+	req := &ModelRequest{Request: httptest.NewRequest("GET", "/", nil)}
+
+	// concurrent misses, a single load
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if data, err := s.loadModel(model, req); err != nil || data != "Alex" {
+				t.Errorf("Syntax.loadModel(model, req) | invalid data\n   actual: %v %v", data, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	s.loadModel(model, req)
+	if loads != 1 {
+		t.Errorf("Syntax.loadModel(model, req) | invalid number of loads\n   actual: %d\n expected: 1", loads)
+	}
+
+	s.initialized = true
+	if err := s.InvalidateModelTag("users"); err != nil {
+		t.Fatal(err)
+	}
+	s.loadModel(model, req)
+	if loads != 2 {
+		t.Errorf("Syntax.InvalidateModelTag(tag) | invalid number of loads\n   actual: %d\n expected: 2", loads)
+	}
+}
+
+func Test_Model_Cache_Invalidation_During_Load(t *testing.T) {
+	s := &Syntax{Config: &Config{}, pubsub: &PubSub{}}
+	if err := s.initModelCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	version := "v1"
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	model := &Model{
+		Name: "user",
+		Prepare: func(req *ModelRequest) *ModelCache {
+			return &ModelCache{Key: "user:1"}
+		},
+		Load: func(req *ModelRequest) (*ModelResult, error) {
+			data := version
+			started <- struct{}{}
+			<-release
+			return &ModelResult{Data: data, Cache: &ModelCache{Tags: []string{"users"}}}, nil
+		},
+	}
+	req := &ModelRequest{Request: httptest.NewRequest("GET", "/", nil)}
+
+	for _, invalidate := range []func(){
+		func() { s.applyModelInvalidation(&modelInvalidation{Key: "user:1"}) },
+		func() { s.applyModelInvalidation(&modelInvalidation{Tag: "users"}) },
+	} {
+		version = "v1"
+		release = make(chan struct{})
+		done := make(chan interface{})
+		go func() {
+			data, _ := s.loadModel(model, req)
+			done <- data
+		}()
+
+		// the data changes while the load is in progress
+		<-started
+		version = "v2"
+		invalidate()
+		close(release)
+		<-done
+
+		release = make(chan struct{})
+		close(release)
+		if data, _ := s.loadModel(model, req); data != "v2" {
+			t.Errorf("Syntax.loadModel(model, req) | the stale result must not be cached\n   actual: %v\n expected: v2", data)
+		}
+		select {
+		case <-started:
+		default:
+		}
+		s.applyModelInvalidation(&modelInvalidation{Key: "user:1"})
+	}
+}
+
+func Test_Model_Cache_Shared_Load(t *testing.T) {
+	s := &Syntax{Config: &Config{}, pubsub: &PubSub{}}
+	if err := s.initModelCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	model := &Model{
+		Name: "user",
+		Prepare: func(req *ModelRequest) *ModelCache {
+			return &ModelCache{Key: "user:1"}
+		},
+		Load: func(req *ModelRequest) (*ModelResult, error) {
+			started <- struct{}{}
+			<-release
+			if err := req.Context.Err(); err != nil {
+				return nil, err
+			}
+			return &ModelResult{Data: "Alex"}, nil
+		},
+	}
+
+	// the request that starts the load is canceled (ex. the client disconnected)
+	ctx, cancel := context.WithCancel(context.Background())
+	first := &ModelRequest{Request: httptest.NewRequest("GET", "/", nil), Context: ctx}
+	go s.loadModel(model, first)
+	<-started
+
+	loaded := make(chan interface{}, 1)
+	go func() {
+		data, err := s.loadModel(model, &ModelRequest{Request: httptest.NewRequest("GET", "/", nil), Context: context.Background()})
+		if err != nil {
+			loaded <- err
+			return
+		}
+		loaded <- data
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	close(release)
+
+	if data := <-loaded; data != "Alex" {
+		t.Errorf("Syntax.loadModel(model, req) | the other requests must not receive the cancellation\n   actual: %v", data)
+	}
+}
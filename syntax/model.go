@@ -1,33 +1,259 @@
 package syntax
 
-//type ModelResult struct {
-//  Data  interface{}
-//  Cache interface{}
-//}
+import (
+	"context"
+	"fmt"
+	"github.com/syntax-framework/chain"
+	"github.com/syntax-framework/shtml/cmn"
+	"github.com/syntax-framework/shtml/sht"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+)
 
+var errorModelNotFound = cmn.Err(
+	"model.notfound",
+	"There is no model registered with the given name.", "Name: %s", "Page: %s",
+)
+
+var errorModelInvalid = cmn.Err(
+	"model.invalid",
+	"The model must have a name and a loader.", "Name: %s",
+)
+
+var errorModelTimeout = cmn.Err(
+	"model.timeout",
+	"The model was not loaded in time.", "Name: %s", "Cause: %s",
+)
+
+var errorModelPanic = cmn.Err(
+	"model.panic",
+	"The loader of the model panicked.", "Key: %s", "Cause: %v",
+)
+
+// pageModelsKey key, in the compile context, of the names of the models declared by the page
+const pageModelsKey = "syntax.page.models"
+
+// modelErrorsKey key, in the sht.Context, of the errors of the models that failed with the fallback policy
+const modelErrorsKey = "syntax.model.errors"
+
+// ModelResult the data loaded by the model
 type ModelResult struct {
 	Data  interface{}
-	Cache interface{}
+	Cache *ModelCache // changes the expiration and the tags informed by Model.Prepare
+}
+
+// WithCache changes the expiration and adds tags to the cached result
+func (r *ModelResult) WithCache(ttl time.Duration, tags ...string) *ModelResult {
+	r.Cache = &ModelCache{TTL: ttl, Tags: tags}
+	return r
+}
+
+// ModelRequest the request of the page, available to the loader of the model
+type ModelRequest struct {
+	Request *http.Request
+	Context context.Context   // canceled when the request ends or the time to load expires (cached models, see loadModel)
+	Params  map[string]string // route params, see pageRoutePath
+}
+
+// Param value of a route param
+func (r *ModelRequest) Param(name string) string {
+	return r.Params[name]
+}
+
+// ModelLoader loads the data of the model
+type ModelLoader func(req *ModelRequest) (*ModelResult, error)
+
+// Model data used by the pages. The page declares the models it needs (`<page model="user, posts">` or
+// `<model name="user" />`), the loaders run before the page is rendered and the Data is available in the root scope,
+// with the name of the model (ex. `{user.name}`)
+//
+// When Prepare returns a cache key, the Data is cached and the loader only runs on cache misses.
+//
+//	&Model{
+//		Name: "user",
+//		Prepare: func(req *ModelRequest) *ModelCache {
+//			return &ModelCache{Key: "user:" + req.Param("id"), TTL: time.Minute, Tags: []string{"users"}}
+//		},
+//		Load: loadUser,
+//	}
+type Model struct {
+	Name      string
+	Prepare   func(req *ModelRequest) *ModelCache
+	Load      ModelLoader
+	OnFailure ModelFailurePolicy
+}
+
+// ModelFailurePolicy what happens to the page when the loader of a model fails
+type ModelFailurePolicy uint8
+
+const (
+	ModelFailureDefault     ModelFailurePolicy = iota // defined by Config.ModelFailure
+	ModelFailureError                                 // responds 500
+	ModelFailureUnavailable                           // responds 503
+	ModelFailureFallback                              // renders the page, the content of `<model>` is shown in place
+)
+
+// pageModels names of the models declared by the template being compiled
+func pageModels(ctx *sht.Context) []string {
+	names, _ := ctx.Get(pageModelsKey).([]string)
+	return names
+}
+
+// addPageModels adds the models declared in the attribute, comma separated
+func addPageModels(ctx *sht.Context, value string) {
+	names := pageModels(ctx)
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		exists := false
+		for _, other := range names {
+			if other == name {
+				exists = true
+			}
+		}
+		if !exists {
+			names = append(names, name)
+		}
+	}
+	ctx.Set(pageModelsKey, names)
 }
 
-func (r ModelResult) WithCache() {
+// ModelDirective declares a model used by the page, `<model name="user" />`. The content of the element is the
+// fallback, rendered only when the model fails (see ModelFailureFallback)
+//
+//	<model name="posts">
+//		<p>The posts are not available right now.</p>
+//	</model>
+var ModelDirective = &sht.Directive{
+	Name:       "model",
+	Restrict:   sht.ELEMENT,
+	Priority:   200,
+	Terminal:   true,
+	Transclude: true,
+	Compile: func(node *sht.Node, attrs *sht.Attributes, t *sht.Compiler) (*sht.DirectiveMethods, error) {
+		name := strings.TrimSpace(attrs.Get("name"))
+		addPageModels(t.Context, name)
 
+		return &sht.DirectiveMethods{
+			Process: func(scope *sht.Scope, attrs *sht.Attributes, transclude sht.TranscludeFunc) *sht.Rendered {
+				if failed, _ := scope.Context.Get(modelErrorsKey).(map[string]error); failed[name] != nil {
+					return transclude("", nil)
+				}
+				return nil
+			},
+		}, nil
+	},
 }
 
-func (r ModelResult) CaseNotInCache(func()) {
+// getModel obtains a registered model by name
+func (s *Syntax) getModel(name string) *Model {
+	for _, model := range s.models {
+		if model.Name == name {
+			return model
+		}
+	}
+	return nil
+}
 
+// resolvePageModels obtains the models declared by the page
+func (s *Syntax) resolvePageModels(ctx *sht.Context, file string) ([]*Model, error) {
+	var models []*Model
+	for _, name := range pageModels(ctx) {
+		model := s.getModel(name)
+		if model == nil {
+			return nil, errorModelNotFound(name, file)
+		}
+		models = append(models, model)
+	}
+	return models, nil
 }
 
-type Model interface {
-	Before() ModelResult
-	//Data(request Request, ctx context.Context, ModelResult) ModelResult
-	//Procces(request Request, ctx context.Context, Config) ModelResult
+// modelLoaded result of the loader of a model
+type modelLoaded struct {
+	data    interface{}
+	err     error
+	elapsed time.Duration
+	panic   *pagePanic
 }
 
-//func Prepare(params) ModelResult {
-//  return ModelResult{
-//    Cache: {
-//      id: "pxoto" + pamras.id,
-//    },
-//  }
-//}
+// loadModels runs, concurrently, the loaders of the models of the page. The Data is placed in the root scope.
+//
+// When a model fails, returns the http status of the response, according to the ModelFailurePolicy. With the
+// fallback policy, the page is rendered and the content of the `<model>` element is shown in place.
+func (s *Syntax) loadModels(models []*Model, ctx *chain.Context, params map[string]string, rootScope *sht.Scope) (int, error) {
+	reqCtx := ctx.Request.Context()
+	if s.Config.ModelTimeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(reqCtx, time.Duration(s.Config.ModelTimeout)*time.Millisecond)
+		defer cancel()
+	}
+	req := &ModelRequest{Request: ctx.Request, Context: reqCtx, Params: params}
+
+	timing := rootScope.Context.Timing
+	metrics := make([]*cmn.ServerTimingMetric, len(models))
+	loads := make([]chan *modelLoaded, len(models))
+	start := time.Now()
+	for i, model := range models {
+		metrics[i] = timing.Metric("mdl-"+model.Name, "<!{S}> Model "+model.Name)
+		loads[i] = make(chan *modelLoaded, 1)
+		go func(model *Model, loaded chan *modelLoaded) {
+			defer func() {
+				// the panic is raised again on the request, see initErrorPages
+				if rcv := recover(); rcv != nil {
+					loaded <- &modelLoaded{panic: &pagePanic{value: rcv, stack: debug.Stack()}}
+				}
+			}()
+			data, err := s.loadModel(model, req)
+			loaded <- &modelLoaded{data: data, err: err, elapsed: time.Since(start)}
+		}(model, loads[i])
+	}
+
+	status := 0
+	var statusErr error
+	failed := map[string]error{}
+	for i, model := range models {
+		var loaded *modelLoaded
+		select {
+		case loaded = <-loads[i]:
+		case <-reqCtx.Done():
+			loaded = &modelLoaded{err: errorModelTimeout(model.Name, reqCtx.Err()), elapsed: time.Since(start)}
+		}
+		if loaded.panic != nil {
+			panic(loaded.panic)
+		}
+		metrics[i].Duration = fmt.Sprintf("%.3f", float64(loaded.elapsed.Microseconds())/1000)
+
+		if loaded.err == nil {
+			rootScope.Set(model.Name, loaded.data)
+			continue
+		}
+
+		rootScope.Set(model.Name, nil)
+		policy := model.OnFailure
+		if policy == ModelFailureDefault {
+			policy = s.Config.modelFailurePolicy()
+		}
+		switch policy {
+		case ModelFailureFallback:
+			log.Printf("[syntax] unable to load the model %s. %s", model.Name, loaded.err)
+			failed[model.Name] = loaded.err
+		case ModelFailureUnavailable:
+			if status == 0 {
+				status, statusErr = http.StatusServiceUnavailable, loaded.err
+			}
+		default:
+			if status == 0 {
+				status, statusErr = http.StatusInternalServerError, loaded.err
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		rootScope.Context.Set(modelErrorsKey, failed)
+	}
+	return status, statusErr
+}
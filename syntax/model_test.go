@@ -0,0 +1,110 @@
+package syntax
+
+import (
+	"errors"
+	"github.com/syntax-framework/chain"
+	"github.com/syntax-framework/shtml/sht"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// newTestSyntax creates a Syntax that loads the pages from memory
+func newTestSyntax(files map[string]string) *Syntax {
+	fsys := fstest.MapFS{}
+	for name, content := range files {
+		fsys[strings.TrimPrefix(name, "/")] = &fstest.MapFile{Data: []byte(content)}
+	}
+	s := &Syntax{
+		Config:          &Config{},
+		Bundler:         &Bundler{},
+		router:          chain.New(),
+		liveControllers: &liveControllers{},
+		filesLookup:     map[string]*FileSystem{},
+		FileSystems:     []*FileSystem{{fs: fsys}},
+	}
+	s.Template = &sht.TemplateSystem{Loader: s.loadFile, Directives: &sht.Directives{}}
+	s.registerDirectives()
+	return s
+}
+
+func Test_Page_Models(t *testing.T) {
+	s := newTestSyntax(map[string]string{
+		"user.html":          `<page model="user"></page><model name="posts" /><b>{user}</b><i>{posts}</i>`,
+		"missing.html":       `<model name="unknown" />`,
+		"/_layout/root.html": `!{content}`,
+	})
+
+	fail := false
+	s.Register(&Model{Name: "user", Load: func(req *ModelRequest) (*ModelResult, error) {
+		return &ModelResult{Data: "Alex " + req.Request.URL.Query().Get("v")}, nil
+	}})
+	s.Register(&Model{Name: "posts", Load: func(req *ModelRequest) (*ModelResult, error) {
+		if fail {
+			return nil, errors.New("database offline")
+		}
+		return &ModelResult{Data: "3 posts"}, nil
+	}})
+
+	if err := s.processPage("missing.html"); err == nil || !strings.Contains(err.Error(), "model.notfound") {
+		t.Errorf("Syntax.processPage(file) | expected model not found\n   actual: %v", err)
+	}
+	if err := s.processPage("user.html"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("GET", "/user.html?v=1", nil))
+	if body := w.Body.String(); !strings.Contains(body, "<b>Alex 1</b><i>3 posts</i>") {
+		t.Errorf("Syntax.renderPage(ctx, page) | invalid output\n   actual: %s", body)
+	}
+
+	fail = true
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("GET", "/user.html", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Syntax.renderPage(ctx, page) | invalid status\n   actual: %d", w.Code)
+	}
+}
+
+func Test_Page_Models_Failure(t *testing.T) {
+	s := newTestSyntax(map[string]string{
+		"feed.html":     `<model name="slow" /><model name="news"><p>No news</p></model><b>{slow}</b>`,
+		"/_layout/root": `!{content}`,
+	})
+	s.Config.Dev = true
+	s.Config.ModelTimeout = 50
+
+	s.Register(&Model{Name: "slow", Load: func(req *ModelRequest) (*ModelResult, error) {
+		time.Sleep(20 * time.Millisecond)
+		return &ModelResult{Data: "done"}, nil
+	}})
+	s.Register(&Model{Name: "news", OnFailure: ModelFailureFallback, Load: func(req *ModelRequest) (*ModelResult, error) {
+		<-req.Context.Done()
+		return nil, req.Context.Err()
+	}})
+	if err := s.processPage("feed.html"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("GET", "/feed.html", nil))
+	if body := w.Body.String(); !strings.Contains(body, "<p>No news</p>") || !strings.Contains(body, "<b>done</b>") {
+		t.Errorf("Syntax.renderPage(ctx, page) | invalid output\n   actual: %s", body)
+	}
+	timing := w.Header().Get("Server-Timing")
+	if !strings.Contains(timing, "mdl-slow;dur=") || !strings.Contains(timing, "mdl-news;dur=") {
+		t.Errorf("Syntax.loadModels() | invalid Server-Timing\n   actual: %s", timing)
+	}
+
+	s.Config.ModelFailure = "unavailable"
+	s.getModel("news").OnFailure = ModelFailureDefault
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("GET", "/feed.html", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Syntax.renderPage(ctx, page) | invalid status\n   actual: %d", w.Code)
+	}
+}
@@ -40,6 +40,9 @@ var PageDirective = &sht.Directive{
 		checkPageConfig(compileConfig)
 		t.Context.Set(PageConfigKey, compileConfig)
 
+		// <page model="user, posts">
+		addPageModels(t.Context, attrs.Get("model"))
+
 		return &sht.DirectiveMethods{
 			Process: func(scope *sht.Scope, attrs *sht.Attributes, _ sht.TranscludeFunc) *sht.Rendered {
 				runtimeConfig := &PageConfig{
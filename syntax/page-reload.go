@@ -0,0 +1,202 @@
+package syntax
+
+import (
+	"github.com/syntax-framework/shtml/cmn"
+	"github.com/syntax-framework/shtml/sht"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// pageGraph dependencies of the pages, the files loaded to compile each page (the page itself, layout, includes and
+// scripts). Decides which pages are compiled again when a file changes in development.
+type pageGraph struct {
+	mutex        sync.RWMutex
+	dependencies map[string]map[string]bool // files by page
+	dependents   map[string]map[string]bool // pages by file
+}
+
+// pageGraphKey normalized path of the file, with leading slash
+func pageGraphKey(file string) string {
+	return "/" + strings.TrimPrefix(file, "/")
+}
+
+// set replaces the dependencies of the page
+func (g *pageGraph) set(page string, files map[string]bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.remove(page)
+	if g.dependencies == nil {
+		g.dependencies = map[string]map[string]bool{}
+		g.dependents = map[string]map[string]bool{}
+	}
+
+	dependencies := map[string]bool{}
+	for file := range files {
+		key := pageGraphKey(file)
+		dependencies[key] = true
+		if g.dependents[key] == nil {
+			g.dependents[key] = map[string]bool{}
+		}
+		g.dependents[key][page] = true
+	}
+	g.dependencies[page] = dependencies
+}
+
+// delete removes the page from the graph
+func (g *pageGraph) delete(page string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.remove(page)
+}
+
+func (g *pageGraph) remove(page string) {
+	for key := range g.dependencies[page] {
+		delete(g.dependents[key], page)
+		if len(g.dependents[key]) == 0 {
+			delete(g.dependents, key)
+		}
+	}
+	delete(g.dependencies, page)
+}
+
+// pages that depend on the file
+func (g *pageGraph) pages(file string) []string {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	var pages []string
+	for page := range g.dependents[pageGraphKey(file)] {
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// isPageFile checks if the file is served as a page, html files outside the directories starting with `_`
+func isPageFile(file string) bool {
+	if !strings.HasSuffix(file, ".html") {
+		return false
+	}
+	for _, segment := range strings.Split(strings.TrimPrefix(file, "/"), "/") {
+		if strings.HasPrefix(segment, "_") {
+			return false
+		}
+	}
+	return true
+}
+
+// liveReloadChanged compiles again the pages and rebuilds the assets of the changed files, before the browser reloads
+func (s *Syntax) liveReloadChanged(event *liveReloadEvent) {
+	s.reloadFiles(event.Paths)
+	event.Assets = s.reloadAssets(event.Paths)
+}
+
+// reloadAssets rebuilds the assets loaded from the changed files and the bundles that contain them, changing their
+// fingerprint. Returns the stylesheets, that can be replaced without reloading the page.
+func (s *Syntax) reloadAssets(paths []string) []*liveReloadAsset {
+	var changed []*cmn.Asset
+	previous := map[*cmn.Asset]*cmn.Asset{} // bundle displayed by the browser
+	for _, path := range paths {
+		for _, asset := range s.Bundler.getAssetsByFilepath(path) {
+			content, err := s.loadFile(asset.Filepath)
+			if err != nil {
+				log.Printf("[syntax] unable to reload the asset %s. %s", asset.Filepath, err)
+				continue
+			}
+
+			previous[asset] = s.Bundler.getBundle(asset)
+			asset.Content = []byte(content)
+			asset.Size = int64(len(asset.Content))
+			asset.Etag = sht.HashXXH64(asset.Content)
+			if asset.Integrity != "" {
+				asset.Integrity = "sha512-" + sht.HashSha512Base64(asset.Content)
+			}
+			changed = append(changed, asset)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	s.Bundler.invalidate()
+
+	var styles []*liveReloadAsset
+	replaced := map[string]bool{}
+	for _, asset := range changed {
+		if asset.Type != cmn.Stylesheet || replaced[previous[asset].Name] {
+			continue
+		}
+		bundle := s.Bundler.getBundle(asset)
+		replaced[previous[asset].Name] = true
+		styles = append(styles, &liveReloadAsset{
+			Name:      bundle.Name,
+			Previous:  previous[asset].Name,
+			Href:      styleHref(bundle),
+			Integrity: bundle.Integrity,
+		})
+	}
+	return styles
+}
+
+// forgetFile invalidates the FileSystem where the file was found
+func (s *Syntax) forgetFile(file string) {
+	s.filesMutex.Lock()
+	defer s.filesMutex.Unlock()
+	delete(s.filesLookup, pageGraphKey(file))
+	delete(s.filesLookup, strings.TrimPrefix(file, "/"))
+}
+
+// reloadFiles compiles again the pages affected by the changed files (paths relative to the FileSystem, ex.
+// `/_layout/root.html`). Routes are added for new pages and removed for deleted pages, the error pages affected are
+// discarded. Used in development.
+func (s *Syntax) reloadFiles(paths []string) {
+	recompile := map[string]*pageRoute{}
+	for _, path := range paths {
+		s.forgetFile(path)
+
+		if isPageFile(path) {
+			file := strings.TrimPrefix(path, "/")
+			_, errLoad := s.loadFile(file)
+			s.pageRoutesMutex.RLock()
+			page := s.pageRoutes[file]
+			s.pageRoutesMutex.RUnlock()
+
+			if errLoad != nil && page != nil {
+				s.removePage(page)
+				continue
+			} else if errLoad == nil && page == nil {
+				if err := s.processPage(file); err != nil {
+					log.Printf("[syntax] unable to compile the page %s. %s", file, err)
+				}
+				continue
+			}
+		}
+
+		s.pageRoutesMutex.RLock()
+		for _, file := range s.pageGraph.pages(path) {
+			if page := s.pageRoutes[file]; page != nil {
+				recompile[file] = page
+			}
+		}
+		s.pageRoutesMutex.RUnlock()
+	}
+
+	for _, page := range recompile {
+		if err := s.compilePage(page); err != nil {
+			log.Printf("[syntax] unable to recompile the page %s. %s", page.file, err)
+		}
+	}
+	s.invalidateErrorPages(paths)
+}
+
+// removePage removes the route of a deleted page
+func (s *Syntax) removePage(page *pageRoute) {
+	s.pageRoutesMutex.Lock()
+	delete(s.pageRoutes, page.file)
+	s.pageRoutesMutex.Unlock()
+
+	s.pageGraph.delete(page.file)
+	s.Bundler.SetPageAssets(page.path, nil)
+	s.removeRoute(http.MethodGet, page.path)
+}
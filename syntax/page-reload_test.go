@@ -0,0 +1,161 @@
+package syntax
+
+import (
+	"github.com/syntax-framework/chain"
+	"github.com/syntax-framework/shtml/cmn"
+	"github.com/syntax-framework/shtml/sht"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_Page_Reload(t *testing.T) {
+	s := newTestSyntax(map[string]string{
+		"index.html":         `<page title="Home"></page><b>home</b>`,
+		"users/[id].html":    `<page></page><b>{params.id}</b>`,
+		"/_layout/root.html": `<main>!{content}</main>`,
+	})
+	s.Config.Dev = true
+	s.initErrorPages()
+	if err := s.servePages(); err != nil {
+		t.Fatal(err)
+	}
+	s.serving = true
+	fsys := s.FileSystems[0].fs.(fstest.MapFS)
+
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	if pages := s.pageGraph.pages("/_layout/root.html"); len(pages) != 2 {
+		t.Errorf("pageGraph.pages(layout) | invalid pages\n   actual: %v", pages)
+	}
+
+	// layout changed, all pages compiled again
+	fsys["_layout/root.html"] = &fstest.MapFile{Data: []byte(`<section>!{content}</section>`)}
+	s.reloadFiles([]string{"/_layout/root.html"})
+	if _, body := get("/users/7"); body != "<section><b>7</b></section>" {
+		t.Errorf("Syntax.reloadFiles(layout) | invalid output\n   actual: %s", body)
+	}
+
+	// page changed
+	fsys["index.html"] = &fstest.MapFile{Data: []byte(`<page></page><b>welcome</b>`)}
+	s.reloadFiles([]string{"/index.html"})
+	if _, body := get("/"); body != "<section><b>welcome</b></section>" {
+		t.Errorf("Syntax.reloadFiles(page) | invalid output\n   actual: %s", body)
+	}
+
+	// page created and removed
+	fsys["about.html"] = &fstest.MapFile{Data: []byte(`<page></page><b>about</b>`)}
+	s.reloadFiles([]string{"/about.html"})
+	if code, body := get("/about.html"); code != http.StatusOK || body != "<section><b>about</b></section>" {
+		t.Errorf("Syntax.reloadFiles(created) | invalid output\n   actual: %d %s", code, body)
+	}
+
+	delete(fsys, "about.html")
+	s.reloadFiles([]string{"/about.html"})
+	if code, _ := get("/about.html"); code != http.StatusNotFound {
+		t.Errorf("Syntax.reloadFiles(removed) | invalid status\n   actual: %d\n expected: 404", code)
+	}
+	if _, exists := s.filesLookup["about.html"]; exists {
+		t.Errorf("Syntax.reloadFiles(removed) | the lookup of the file must be invalidated")
+	}
+	if code, _ := get("/users/7"); code != http.StatusOK {
+		t.Errorf("Syntax.reloadFiles(removed) | the other routes must be kept\n   actual: %d", code)
+	}
+
+	// page created with a route that conflicts with an existing page
+	fsys["users/[name].html"] = &fstest.MapFile{Data: []byte(`<page></page><b>{params.name}</b>`)}
+	s.reloadFiles([]string{"/users/[name].html"})
+	if _, body := get("/users/7"); body != "<section><b>7</b></section>" {
+		t.Errorf("Syntax.reloadFiles(conflict) | the existing route must be kept\n   actual: %s", body)
+	}
+}
+
+func Test_Reload_Assets(t *testing.T) {
+	s := newTestSyntax(map[string]string{
+		"assets/css/site.css": `b{}`,
+	})
+	style := &cmn.Asset{Name: "site", Type: cmn.Stylesheet, Filepath: "/assets/css/site.css", Content: []byte(`b{}`)}
+	style.Etag = sht.HashXXH64(style.Content)
+	style.Integrity = "sha512-" + sht.HashSha512Base64(style.Content)
+	s.Bundler.SetPageAssets("/", []*cmn.Asset{style})
+	etag := style.Etag
+	previous := s.Bundler.getBundle(style)
+
+	fsys := s.FileSystems[0].fs.(fstest.MapFS)
+	fsys["assets/css/site.css"] = &fstest.MapFile{Data: []byte(`b{color:red}`)}
+
+	event := &liveReloadEvent{Type: "css", Paths: []string{"/assets/css/site.css"}}
+	s.liveReloadChanged(event)
+
+	if string(style.Content) != `b{color:red}` || style.Etag == etag {
+		t.Errorf("Syntax.reloadAssets(paths) | the asset must be rebuilt\n   actual: %s %s", style.Content, style.Etag)
+	}
+	bundle := s.Bundler.getBundle(style)
+	if bundle.Name == previous.Name || !strings.Contains(string(bundle.Content), `b{color:red}`) {
+		t.Errorf("Syntax.reloadAssets(paths) | the bundle must be rebuilt\n   actual: %s %s", bundle.Name, bundle.Content)
+	}
+	expected := &liveReloadAsset{
+		Name:      bundle.Name,
+		Previous:  previous.Name,
+		Href:      "/assets/css/" + bundle.Name + ".css",
+		Integrity: bundle.Integrity,
+	}
+	if len(event.Assets) != 1 || !reflect.DeepEqual(event.Assets[0], expected) {
+		t.Errorf("Syntax.liveReloadChanged(event) | invalid assets\n   actual: %+v\n expected: %+v", event.Assets, expected)
+	}
+	if styles := s.Bundler.GetStyles("/"); !strings.Contains(styles, `href="`+expected.Href+`" data-asset="`+bundle.Name+`"`) {
+		t.Errorf("Bundler.GetStyles(page) | invalid output\n   actual: %s", styles)
+	}
+}
+
+// testInitMiddleware counts the calls to Init
+type testInitMiddleware struct {
+	inits int
+}
+
+func (m *testInitMiddleware) Init(router *chain.Router) {
+	m.inits++
+}
+
+func (m *testInitMiddleware) Handle(ctx *chain.Context, next func() error) error {
+	ctx.Writer.Header().Set("X-Middleware", "true")
+	return next()
+}
+
+func Test_Rebuild_Router(t *testing.T) {
+	s := newTestSyntax(nil)
+	s.router.RedirectTrailingSlash = false
+	s.router.HandleMethodNotAllowed = false
+	s.router.GlobalOPTIONSHandler = http.NotFoundHandler()
+	middleware := &testInitMiddleware{}
+	s.Use(middleware)
+	s.serving = true
+
+	// routes added while serving rebuild the router
+	s.GET("/users", func(ctx *chain.Context) {})
+	router := s.router
+	if router.RedirectTrailingSlash || router.HandleMethodNotAllowed || router.GlobalOPTIONSHandler == nil || !router.RedirectFixedPath {
+		t.Errorf("Syntax.rebuildRouter() | the settings of the router must be kept\n   actual: %+v", router)
+	}
+	if middleware.inits != 1 {
+		t.Errorf("Syntax.rebuildRouter() | the middlewares must not be initialized again\n   actual: %d", middleware.inits)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/users", nil))
+	if w.Header().Get("X-Middleware") != "true" {
+		t.Errorf("Syntax.rebuildRouter() | the middlewares must be kept")
+	}
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/users/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Syntax.rebuildRouter() | RedirectTrailingSlash must be kept\n   actual: %d", w.Code)
+	}
+}
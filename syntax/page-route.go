@@ -0,0 +1,78 @@
+package syntax
+
+import (
+	"github.com/syntax-framework/chain"
+	"github.com/syntax-framework/shtml/cmn"
+	"regexp"
+	"strings"
+)
+
+// RouteParamsKey key of the route params (map[string]string) in the sht.Context, available while rendering a page
+const RouteParamsKey = "syntax.route.params"
+
+var errorPageRouteInvalid = cmn.Err(
+	"page.route.invalid",
+	"The name of the file is not a valid route. Dynamic segments must be the whole name, as `[id].html` or `[...rest].html`.",
+	"File: %s",
+)
+
+// pageRouteParamRegex `[id]` or `[...rest]`
+var pageRouteParamRegex = regexp.MustCompile(`^\[(\.\.\.)?([a-zA-Z_][a-zA-Z0-9_]*)]$`)
+
+// pageRoutePath converts the path of the page file to the path of the route. Files and directories named `[id]`
+// are named params (`/users/[id].html` is `/users/:id`) and `[...rest]` is a catch-all param, only allowed in the last
+// segment (`/docs/[...path].html` is `/docs/*path`). Returns the names of the params.
+func pageRoutePath(file string) (string, []string, error) {
+	path := file
+	if path[0] != '/' {
+		path = "/" + path
+	}
+
+	if strings.HasSuffix(path, "/index.html") {
+		path = strings.TrimSuffix(path, "index.html")
+	}
+
+	if !strings.Contains(path, "[") {
+		return path, nil, nil
+	}
+
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if !strings.ContainsAny(segment, "[]") {
+			continue
+		}
+
+		last := i == len(segments)-1
+		name := segment
+		if last {
+			name = strings.TrimSuffix(segment, ".html")
+		}
+
+		match := pageRouteParamRegex.FindStringSubmatch(name)
+		if match == nil {
+			return "", nil, errorPageRouteInvalid(file)
+		}
+
+		if match[1] != "" {
+			if !last {
+				return "", nil, errorPageRouteInvalid(file)
+			}
+			segments[i] = "*" + match[2]
+		} else {
+			segments[i] = ":" + match[2]
+		}
+		params = append(params, match[2])
+	}
+	return strings.Join(segments, "/"), params, nil
+}
+
+// routeParams the values of the route params of the request. The value of the catch-all param has no leading slash
+// (`/docs/guide/install` is `guide/install`)
+func routeParams(ctx *chain.Context, names []string) map[string]string {
+	params := map[string]string{}
+	for _, name := range names {
+		params[name] = strings.TrimPrefix(ctx.GetParam(name), "/")
+	}
+	return params
+}
@@ -0,0 +1,131 @@
+package syntax
+
+import (
+	"github.com/syntax-framework/chain"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_Page_Route_Path(t *testing.T) {
+	tests := []struct {
+		file   string
+		path   string
+		params []string
+		err    bool
+	}{
+		{file: "index.html", path: "/"},
+		{file: "about.html", path: "/about.html"},
+		{file: "users/[id].html", path: "/users/:id", params: []string{"id"}},
+		{file: "[org]/repos/index.html", path: "/:org/repos/", params: []string{"org"}},
+		{file: "[org]/[repo].html", path: "/:org/:repo", params: []string{"org", "repo"}},
+		{file: "docs/[...path].html", path: "/docs/*path", params: []string{"path"}},
+		{file: "docs/[...path]/edit.html", err: true},
+		{file: "users/user-[id].html", err: true},
+	}
+	for _, tt := range tests {
+		path, params, err := pageRoutePath(tt.file)
+		if tt.err {
+			if err == nil || !strings.Contains(err.Error(), "page.route.invalid") {
+				t.Errorf("pageRoutePath(%s) | expected error\n   actual: %v", tt.file, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("pageRoutePath(%s) | unexpected error %v", tt.file, err)
+			continue
+		}
+		if path != tt.path || !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("pageRoutePath(%s) | invalid route\n   actual: %s %v\n expected: %s %v", tt.file, path, params, tt.path, tt.params)
+		}
+	}
+}
+
+func Test_Page_Route_Params(t *testing.T) {
+	s := newTestSyntax(map[string]string{
+		"users/[id].html":     `<model name="user" /><b>{params.id}</b><i>{user}</i>`,
+		"docs/[...path].html": `<b>{params.path}</b>`,
+		"/_layout/root":       `!{content}`,
+	})
+	s.Register(&Model{Name: "user", Load: func(req *ModelRequest) (*ModelResult, error) {
+		return &ModelResult{Data: "user " + req.Param("id")}, nil
+	}})
+	for _, file := range []string{"users/[id].html", "docs/[...path].html"} {
+		if err := s.processPage(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := map[string]string{
+		"/users/42":           "<b>42</b><i>user 42</i>",
+		"/docs/guide/install": "<b>guide/install</b>",
+	}
+	for url, expected := range tests {
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if body := w.Body.String(); !strings.Contains(body, expected) {
+			t.Errorf("Syntax.renderPage(%s) | invalid output\n   actual: %s\n expected: %s", url, body, expected)
+		}
+	}
+}
+
+func Test_Page_Route_Conflict(t *testing.T) {
+	s := newTestSyntax(map[string]string{
+		"users/[id].html":   `<b>{params.id}</b>`,
+		"users/[name].html": `<b>{params.name}</b>`,
+		"/_layout/root":     `!{content}`,
+	})
+	if err := s.processPage("users/[id].html"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.processPage("users/[name].html"); err == nil || !strings.Contains(err.Error(), "router.route.conflict") {
+		t.Errorf("Syntax.processPage(file) | expected route conflict\n   actual: %v", err)
+	}
+	if s.pageRoutes["users/[name].html"] != nil {
+		t.Errorf("Syntax.processPage(file) | the page must not be added")
+	}
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("GET", "/users/42", nil))
+	if body := w.Body.String(); !strings.Contains(body, "<b>42</b>") {
+		t.Errorf("Syntax.processPage(file) | the existing route must be kept\n   actual: %s", body)
+	}
+
+	// other methods don't conflict
+	if err := s.addRoute("POST", "/users/:name", func(ctx *chain.Context) {}); err != nil {
+		t.Errorf("Syntax.addRoute(method, path) | unexpected error %v", err)
+	}
+}
+
+func Test_Route_Replace(t *testing.T) {
+	s := newTestSyntax(nil)
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Body.String()
+	}
+	handle := func(body string) func(ctx *chain.Context) {
+		return func(ctx *chain.Context) {
+			ctx.Writer.Write([]byte(body))
+		}
+	}
+
+	s.GET("/users/:id", handle("v1"))
+	s.GET("/users/:id", handle("v2"))
+	if body := get("/users/7"); body != "v2" {
+		t.Errorf("Syntax.Handle(method, path) | the route must be replaced\n   actual: %s", body)
+	}
+
+	s.serving = true
+	s.GET("/users/:id", handle("v3"))
+	if body := get("/users/7"); body != "v3" || len(s.routes) != 1 {
+		t.Errorf("Syntax.Handle(method, path) | the route must be replaced while serving\n   actual: %s %d", body, len(s.routes))
+	}
+
+	// conflicts are not registered
+	s.GET("/users/:name", handle("v4"))
+	if body := get("/users/7"); body != "v3" || len(s.routes) != 1 {
+		t.Errorf("Syntax.Handle(method, path) | the conflicting route must not be registered\n   actual: %s %d", body, len(s.routes))
+	}
+}
@@ -0,0 +1,153 @@
+package syntax
+
+import (
+	"github.com/syntax-framework/shtml/cmn"
+	"sync"
+)
+
+// eventPresenceState event with the full presence state of a topic, sent to the socket that starts being tracked
+const eventPresenceState = "presence_state"
+
+// eventPresenceDiff event with the joins and leaves of a topic, sent to all sockets of the topic
+const eventPresenceDiff = "presence_diff"
+
+var errorPresenceNotJoined = cmn.Err(
+	"presence.topic.notjoined",
+	"The socket must join the topic before being tracked.", "Channel: %s", "Topic: %s",
+)
+
+// PresenceMeta metadata of a presence (ex. status, device, typing)
+type PresenceMeta map[string]interface{}
+
+// PresenceEntry all presences of the same key (ex. user) in a topic, one meta per socket
+type PresenceEntry struct {
+	Metas []PresenceMeta `json:"metas"`
+}
+
+// PresenceDiff changes in the presence of a topic
+type PresenceDiff struct {
+	Joins  map[string]*PresenceEntry `json:"joins"`
+	Leaves map[string]*PresenceEntry `json:"leaves"`
+}
+
+// Presence keeps the record of who is present in the topics of a Channel. Every change is broadcast to the clients
+// of the topic with the `presence_diff` event.
+type Presence struct {
+	channel *Channel
+	mutex   sync.RWMutex
+	topics  map[string]map[string]map[*Socket]PresenceMeta // topic -> key -> socket -> meta
+}
+
+// Presence gets the presence tracker of this channel
+func (c *Channel) Presence() *Presence {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.presence == nil {
+		c.presence = &Presence{
+			channel: c,
+			topics:  map[string]map[string]map[*Socket]PresenceMeta{},
+		}
+	}
+	return c.presence
+}
+
+// Track starts tracking the socket presence in the topic with the key (ex. user id). The socket receives the current
+// state of the topic and all the other sockets receive the diff. The presence is removed when the socket leaves the
+// topic or when its connection ends.
+func (p *Presence) Track(socket *Socket, topic string, key string, meta PresenceMeta) error {
+	if !socket.Joined(topic) {
+		return errorPresenceNotJoined(p.channel.name, topic)
+	}
+
+	if meta == nil {
+		meta = PresenceMeta{}
+	}
+	tracked := PresenceMeta{}
+	for name, value := range meta {
+		tracked[name] = value
+	}
+	// the id of the connection is never sent to the other clients
+	tracked["ref"] = newPresenceRef()
+
+	p.mutex.Lock()
+	keys, exists := p.topics[topic]
+	if !exists {
+		keys = map[string]map[*Socket]PresenceMeta{}
+		p.topics[topic] = keys
+	}
+	sockets, exists := keys[key]
+	if !exists {
+		sockets = map[*Socket]PresenceMeta{}
+		keys[key] = sockets
+	}
+	previous, isUpdate := sockets[socket]
+	sockets[socket] = tracked
+	p.mutex.Unlock()
+
+	diff := &PresenceDiff{
+		Joins:  map[string]*PresenceEntry{key: {Metas: []PresenceMeta{tracked}}},
+		Leaves: map[string]*PresenceEntry{},
+	}
+	if isUpdate {
+		diff.Leaves[key] = &PresenceEntry{Metas: []PresenceMeta{previous}}
+	}
+
+	if !isUpdate && socket.request != nil {
+		// connection ended
+		go func(done <-chan struct{}) {
+			<-done
+			p.Untrack(socket, topic)
+		}(socket.request.Context().Done())
+	}
+
+	socket.Push(topic, eventPresenceState, p.List(topic))
+	return p.channel.syntax.Broadcast(p.channel.name+":"+topic, eventPresenceDiff, diff)
+}
+
+// Untrack removes the socket presence from the topic
+func (p *Presence) Untrack(socket *Socket, topic string) {
+	p.mutex.Lock()
+	leaves := map[string]*PresenceEntry{}
+	if keys, exists := p.topics[topic]; exists {
+		for key, sockets := range keys {
+			if meta, tracked := sockets[socket]; tracked {
+				delete(sockets, socket)
+				leaves[key] = &PresenceEntry{Metas: []PresenceMeta{meta}}
+				if len(sockets) == 0 {
+					delete(keys, key)
+				}
+			}
+		}
+		if len(keys) == 0 {
+			delete(p.topics, topic)
+		}
+	}
+	p.mutex.Unlock()
+
+	if len(leaves) > 0 {
+		diff := &PresenceDiff{Joins: map[string]*PresenceEntry{}, Leaves: leaves}
+		_ = p.channel.syntax.Broadcast(p.channel.name+":"+topic, eventPresenceDiff, diff)
+	}
+}
+
+// newPresenceRef random identifier of a tracked presence
+func newPresenceRef() string {
+	return newSubscriptionID()
+}
+
+// List the presences of the topic, by key
+func (p *Presence) List(topic string) map[string]*PresenceEntry {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	list := map[string]*PresenceEntry{}
+	for key, sockets := range p.topics[topic] {
+		entry := &PresenceEntry{}
+		for _, meta := range sockets {
+			entry.Metas = append(entry.Metas, meta)
+		}
+		list[key] = entry
+	}
+	return list
+}
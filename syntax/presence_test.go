@@ -0,0 +1,130 @@
+package syntax
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Presence(t *testing.T) {
+	s := &Syntax{pubsub: &PubSub{}, channels: map[string]*Channel{}, sseReplay: newSSEReplay(0, 0), sseHub: newSSEHub()}
+	go s.sseHub.run()
+
+	channel, _ := s.Channel("room")
+	channel.OnJoin("*", func(topic string, params map[string]interface{}, socket *Socket) error {
+		return nil
+	})
+	presence := channel.Presence()
+
+	connect := func() (*SSESubscription, *Socket) {
+		conn := s.sseHub.subscribe(httptest.NewRequest("GET", "/live", nil), 0)
+		<-conn.event // stx_connection
+		socket := conn.socket(channel)
+		if err := channel.requestJoin("lobby", nil, socket); err != nil {
+			t.Fatal(err)
+		}
+		return conn, socket
+	}
+	// alex has two tabs open
+	connA1, socketA1 := connect()
+	connA2, socketA2 := connect()
+	connB, socketB := connect()
+	defer connA1.close()
+	defer connA2.close()
+
+	receiveState := func(conn *SSESubscription) map[string]*PresenceEntry {
+		state := map[string]*PresenceEntry{}
+		receivePresence(t, conn, eventPresenceState, &state)
+		return state
+	}
+	receiveDiff := func(conn *SSESubscription) *PresenceDiff {
+		diff := &PresenceDiff{}
+		receivePresence(t, conn, eventPresenceDiff, diff)
+		return diff
+	}
+
+	if err := presence.Track(socketA1, "lobby", "alex", PresenceMeta{"device": "web"}); err != nil {
+		t.Fatal(err)
+	}
+	if state := receiveState(connA1); len(state) != 1 || len(state["alex"].Metas) != 1 {
+		t.Errorf("Presence.Track(socket) | invalid presence_state\n   actual: %+v", state)
+	}
+	for _, conn := range []*SSESubscription{connA1, connA2, connB} {
+		if diff := receiveDiff(conn); len(diff.Joins["alex"].Metas) != 1 || len(diff.Leaves) != 0 {
+			t.Errorf("Presence.Track(socket) | invalid presence_diff\n   actual: %+v", diff)
+		}
+	}
+
+	presence.Track(socketA2, "lobby", "alex", PresenceMeta{"device": "phone"})
+	state := receiveState(connA2)
+	if len(state["alex"].Metas) != 2 {
+		t.Errorf("Presence.Track(socket) | one meta per socket of the key\n   actual: %+v", state["alex"])
+	}
+	refs := map[interface{}]bool{}
+	for _, meta := range state["alex"].Metas {
+		if meta["ref"] == "" || meta["ref"] == connA1.ID || meta["ref"] == connA2.ID {
+			t.Errorf("Presence.Track(socket) | the ref must not expose the id of the connection\n   actual: %v", meta["ref"])
+		}
+		refs[meta["ref"]] = true
+	}
+	if len(refs) != 2 {
+		t.Errorf("Presence.Track(socket) | the refs must be unique\n   actual: %v", refs)
+	}
+	if diff := receiveDiff(connB); diff.Joins["alex"].Metas[0]["device"] != "phone" {
+		t.Errorf("Presence.Track(socket) | invalid presence_diff\n   actual: %+v", diff.Joins["alex"])
+	}
+	receiveDiff(connA1)
+	receiveDiff(connA2)
+
+	presence.Track(socketB, "lobby", "bob", nil)
+	receiveState(connB)
+	for _, conn := range []*SSESubscription{connA1, connA2, connB} {
+		receiveDiff(conn)
+	}
+
+	// one of the tabs leaves, alex is still present
+	presence.Untrack(socketA2, "lobby")
+	if diff := receiveDiff(connA1); len(diff.Joins) != 0 || diff.Leaves["alex"].Metas[0]["device"] != "phone" {
+		t.Errorf("Presence.Untrack(socket) | invalid presence_diff\n   actual: %+v", diff)
+	}
+	if list := presence.List("lobby"); len(list["alex"].Metas) != 1 || list["alex"].Metas[0]["device"] != "web" {
+		t.Errorf("Presence.Untrack(socket) | the other socket of the key must be kept\n   actual: %+v", list["alex"])
+	}
+
+	// disconnect
+	connB.close()
+	if diff := receiveDiff(connA1); len(diff.Leaves["bob"].Metas) != 1 {
+		t.Errorf("SSESubscription.close() | invalid presence_diff\n   actual: %+v", diff)
+	}
+	if list := presence.List("lobby"); len(list) != 1 || list["bob"] != nil {
+		t.Errorf("SSESubscription.close() | the presence must be removed\n   actual: %+v", list)
+	}
+
+	if err := presence.Track(socketA2, "other", "alex", nil); err == nil {
+		t.Errorf("Presence.Track(socket) | expected error, the socket has not joined the topic")
+	}
+}
+
+// receivePresence waits for the presence event, ignoring the others
+func receivePresence(t *testing.T, conn *SSESubscription, event string, payload interface{}) {
+	t.Helper()
+	for {
+		select {
+		case sse := <-conn.event:
+			raw := &json.RawMessage{}
+			message := &Message{Payload: raw}
+			if err := json.Unmarshal(sse.Data, message); err != nil {
+				t.Fatal(err)
+			}
+			if message.Event == event {
+				if err := json.Unmarshal(*raw, payload); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Presence | timeout waiting %s", event)
+		}
+	}
+}
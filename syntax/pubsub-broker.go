@@ -0,0 +1,366 @@
+package syntax
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/syntax-framework/shtml/cmn"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+var errorPubSubBrokerDisconnected = cmn.Err(
+	"pubsub.broker.disconnected",
+	"There is no connection to the PubSub broker.", "Address: %s",
+)
+
+// brokerFrame the messages exchanged between the broker and the Syntax instances, one JSON per line
+type brokerFrame struct {
+	Op      string          `json:"op"` // "sub" | "unsub" | "pub"
+	Topic   string          `json:"topic"`
+	Message bool            `json:"message,omitempty"` // content is a *Message
+	Content json.RawMessage `json:"content,omitempty"`
+}
+
+// brokerQueueSize default limit of frames waiting to be written to each connection of the broker
+const brokerQueueSize = 1024
+
+// brokerWriteTimeout time limit to write a frame, a connection that doesn't read is dropped
+const brokerWriteTimeout = 10 * time.Second
+
+// brokerConn a Syntax instance connected to the broker
+type brokerConn struct {
+	conn    net.Conn
+	mutex   sync.Mutex
+	encoder *json.Encoder
+	topics  map[string]bool
+	queue   chan *brokerFrame // frames published to this instance, written by PubSubBroker.send
+	done    chan struct{}
+}
+
+func (c *brokerConn) write(frame *brokerFrame) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.conn.SetWriteDeadline(time.Now().Add(brokerWriteTimeout)); err != nil {
+		return err
+	}
+	return c.encoder.Encode(frame)
+}
+
+// enqueue adds the frame to the queue of the connection, returns false when the queue is full
+func (c *brokerConn) enqueue(frame *brokerFrame) bool {
+	select {
+	case c.queue <- frame:
+		return true
+	default:
+		return false
+	}
+}
+
+// PubSubBroker process that routes the content published between Syntax instances, using TCP or Unix socket. Each
+// published content is delivered to all instances subscribed to the topic, except the publisher, which has already
+// delivered it to its own subscribers.
+//
+//	broker, err := syntax.ListenPubSubBroker("unix", "/tmp/syntax-broker.sock")
+//	go broker.Serve()
+type PubSubBroker struct {
+	QueueSize int // limit of frames waiting to be written to each instance. Default 1024
+	listener  net.Listener
+	mutex     sync.RWMutex
+	conns     map[*brokerConn]bool
+}
+
+// ListenPubSubBroker creates a broker listening on the network address
+func ListenPubSubBroker(network string, address string) (*PubSubBroker, error) {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &PubSubBroker{
+		listener: listener,
+		conns:    map[*brokerConn]bool{},
+	}, nil
+}
+
+// Addr address of the broker
+func (b *PubSubBroker) Addr() net.Addr {
+	return b.listener.Addr()
+}
+
+// Serve accepts connections until the broker is closed
+func (b *PubSubBroker) Serve() error {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return err
+		}
+		limit := b.QueueSize
+		if limit <= 0 {
+			limit = brokerQueueSize
+		}
+		go b.handle(&brokerConn{
+			conn:    conn,
+			encoder: json.NewEncoder(conn),
+			topics:  map[string]bool{},
+			queue:   make(chan *brokerFrame, limit),
+			done:    make(chan struct{}),
+		})
+	}
+}
+
+// Close stops the broker and closes all connections
+func (b *PubSubBroker) Close() error {
+	err := b.listener.Close()
+
+	b.mutex.Lock()
+	for conn := range b.conns {
+		conn.conn.Close()
+	}
+	b.mutex.Unlock()
+
+	return err
+}
+
+func (b *PubSubBroker) handle(conn *brokerConn) {
+	b.mutex.Lock()
+	b.conns[conn] = true
+	b.mutex.Unlock()
+
+	defer func() {
+		b.mutex.Lock()
+		delete(b.conns, conn)
+		b.mutex.Unlock()
+		close(conn.done)
+		conn.conn.Close()
+	}()
+
+	go b.send(conn)
+
+	decoder := json.NewDecoder(bufio.NewReader(conn.conn))
+	for {
+		frame := &brokerFrame{}
+		if err := decoder.Decode(frame); err != nil {
+			return
+		}
+
+		switch frame.Op {
+		case "sub":
+			b.mutex.Lock()
+			conn.topics[frame.Topic] = true
+			b.mutex.Unlock()
+		case "unsub":
+			b.mutex.Lock()
+			delete(conn.topics, frame.Topic)
+			b.mutex.Unlock()
+		case "pub":
+			b.mutex.RLock()
+			var targets []*brokerConn
+			for target := range b.conns {
+				if target != conn && target.topics[frame.Topic] {
+					targets = append(targets, target)
+				}
+			}
+			b.mutex.RUnlock()
+
+			// a slow instance doesn't delay the publisher nor the other instances
+			for _, target := range targets {
+				if !target.enqueue(frame) {
+					log.Printf("[syntax] instance connected to the broker is not consuming messages, connection closed")
+					target.conn.Close()
+				}
+			}
+		}
+	}
+}
+
+// send writes the frames published to the instance, until the connection is closed
+func (b *PubSubBroker) send(conn *brokerConn) {
+	for {
+		select {
+		case frame := <-conn.queue:
+			if err := conn.write(frame); err != nil {
+				conn.conn.Close()
+				return
+			}
+		case <-conn.done:
+			return
+		}
+	}
+}
+
+// PubSubBrokerAdapter PubSubAdapter that publishes through a PubSubBroker. The adapter keeps a single connection to
+// the broker, reconnecting and subscribing again to the topics when the connection drops.
+type PubSubBrokerAdapter struct {
+	network string
+	address string
+	local   *PubSub // delivers the content received from the broker to the subscribers of this instance
+	mutex   sync.Mutex
+	conn    *brokerConn
+	topics  map[string]int // number of subscribers of each topic on this instance
+	closed  bool
+}
+
+// NewPubSubBrokerAdapter creates an adapter connected to the broker at the network address
+func NewPubSubBrokerAdapter(network string, address string) *PubSubBrokerAdapter {
+	adapter := &PubSubBrokerAdapter{
+		network: network,
+		address: address,
+		local:   &PubSub{},
+		topics:  map[string]int{},
+	}
+	go adapter.run()
+	return adapter
+}
+
+// Publish delivers the content to the subscribers of this instance and sends it to the broker, for the other
+// instances. While disconnected from the broker, only the other instances don't receive the content and the error is
+// returned.
+func (a *PubSubBrokerAdapter) Publish(topic string, content interface{}) error {
+	if err := a.local.Publish(topic, content); err != nil {
+		return err
+	}
+
+	frame := &brokerFrame{Op: "pub", Topic: topic}
+	if message, isMessage := content.(*Message); isMessage {
+		frame.Message = true
+		content = message
+	}
+
+	data, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	frame.Content = data
+
+	a.mutex.Lock()
+	conn := a.conn
+	a.mutex.Unlock()
+
+	if conn == nil {
+		return errorPubSubBrokerDisconnected(a.address)
+	}
+	return conn.write(frame)
+}
+
+// Subscribe registers the callback locally and, on the first subscriber of the topic, subscribes this instance to
+// the topic in the broker
+func (a *PubSubBrokerAdapter) Subscribe(topic string, callback func(content interface{})) (func(), error) {
+	unsubscribeLocal, err := a.local.Subscribe(topic, callback)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mutex.Lock()
+	a.topics[topic]++
+	if a.topics[topic] == 1 && a.conn != nil {
+		if err = a.conn.write(&brokerFrame{Op: "sub", Topic: topic}); err != nil {
+			log.Printf("[syntax] unable to subscribe to topic %s on broker. %s", topic, err)
+		}
+	}
+	a.mutex.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			unsubscribeLocal()
+
+			a.mutex.Lock()
+			a.topics[topic]--
+			if a.topics[topic] <= 0 {
+				delete(a.topics, topic)
+				if a.conn != nil {
+					_ = a.conn.write(&brokerFrame{Op: "unsub", Topic: topic})
+				}
+			}
+			a.mutex.Unlock()
+		})
+	}, nil
+}
+
+// Close ends the connection with the broker
+func (a *PubSubBrokerAdapter) Close() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.closed = true
+	if a.conn != nil {
+		return a.conn.conn.Close()
+	}
+	return nil
+}
+
+// run keeps the connection with the broker
+func (a *PubSubBrokerAdapter) run() {
+	backoff := 100 * time.Millisecond
+	for {
+		a.mutex.Lock()
+		closed := a.closed
+		a.mutex.Unlock()
+		if closed {
+			return
+		}
+
+		conn, err := net.Dial(a.network, a.address)
+		if err != nil {
+			time.Sleep(backoff)
+			if backoff < 5*time.Second {
+				backoff *= 2
+			}
+			continue
+		}
+		backoff = 100 * time.Millisecond
+
+		a.receive(&brokerConn{conn: conn, encoder: json.NewEncoder(conn)})
+	}
+}
+
+// receive subscribes to the topics of this instance and delivers the content received until the connection drops
+func (a *PubSubBrokerAdapter) receive(conn *brokerConn) {
+	a.mutex.Lock()
+	if a.closed {
+		a.mutex.Unlock()
+		conn.conn.Close()
+		return
+	}
+	for topic := range a.topics {
+		if err := conn.write(&brokerFrame{Op: "sub", Topic: topic}); err != nil {
+			break
+		}
+	}
+	a.conn = conn
+	a.mutex.Unlock()
+
+	defer func() {
+		a.mutex.Lock()
+		a.conn = nil
+		a.mutex.Unlock()
+		conn.conn.Close()
+	}()
+
+	decoder := json.NewDecoder(bufio.NewReader(conn.conn))
+	for {
+		frame := &brokerFrame{}
+		if err := decoder.Decode(frame); err != nil {
+			return
+		}
+		if frame.Op != "pub" {
+			continue
+		}
+
+		var content interface{}
+		var err error
+		if frame.Message {
+			message := &Message{}
+			err = json.Unmarshal(frame.Content, message)
+			content = message
+		} else {
+			err = json.Unmarshal(frame.Content, &content)
+		}
+		if err != nil {
+			log.Printf("[syntax] invalid content received from broker on topic %s. %s", frame.Topic, err)
+			continue
+		}
+		_ = a.local.Publish(frame.Topic, content)
+	}
+}
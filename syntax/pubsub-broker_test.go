@@ -0,0 +1,143 @@
+package syntax
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_PubSub_Broker(t *testing.T) {
+	address := filepath.Join(t.TempDir(), "broker.sock")
+
+	// two instances of the application, started before the broker
+	var instances []*Syntax
+	var conns []*testSocketConn
+	for i := 0; i < 2; i++ {
+		adapter := NewPubSubBrokerAdapter("unix", address)
+		defer adapter.Close()
+
+		s := &Syntax{pubsub: adapter, channels: map[string]*Channel{}, sseReplay: newSSEReplay(0, 0)}
+		channel, err := s.Channel("room")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn := &testSocketConn{events: make(chan *SSEEvent, 100)}
+		if err = channel.join("lobby", &Socket{Channel: channel, conn: conn}); err != nil {
+			t.Fatal(err)
+		}
+		instances = append(instances, s)
+		conns = append(conns, conn)
+	}
+
+	receive := func(conn *testSocketConn, timeout time.Duration) *Message {
+		select {
+		case event := <-conn.events:
+			message := &Message{}
+			if err := json.Unmarshal(event.Data, message); err != nil {
+				t.Fatal(err)
+			}
+			return message
+		case <-time.After(timeout):
+			return nil
+		}
+	}
+
+	// without broker, only the other instances miss the content
+	if err := instances[0].Broadcast("room:lobby", "new_msg", "local"); err == nil {
+		t.Errorf("PubSubBrokerAdapter.Publish(topic, content) | expected error while disconnected")
+	}
+	if message := receive(conns[0], time.Second); message == nil || message.Payload != "local" {
+		t.Errorf("PubSubBrokerAdapter.Publish(topic, content) | local subscribers must receive while disconnected\n   actual: %+v", message)
+	}
+
+	broker, err := ListenPubSubBroker("unix", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go broker.Serve()
+	defer broker.Close()
+
+	// publishes until the two instances are connected to the broker
+	published := 0
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err = instances[0].Broadcast("room:lobby", "new_msg", "hello")
+		published++
+		if message := receive(conns[1], 50*time.Millisecond); message != nil {
+			if message.Event != "new_msg" || message.Payload != "hello" {
+				t.Errorf("PubSubBrokerAdapter.Publish(topic, content) | invalid output\n   actual: %+v", message)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("PubSubBrokerAdapter.Publish(topic, content) | timeout\n   error: %v", err)
+		}
+	}
+
+	// the publisher is not delivered twice
+	received := 0
+	for receive(conns[0], 100*time.Millisecond) != nil {
+		received++
+	}
+	if received != published {
+		t.Errorf("PubSubBrokerAdapter.Publish(topic, content) | invalid number of local deliveries\n   actual: %d\n expected: %d", received, published)
+	}
+}
+
+func Test_PubSub_Broker_Slow_Instance(t *testing.T) {
+	broker, err := ListenPubSubBroker("unix", filepath.Join(t.TempDir(), "broker.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker.QueueSize = 2
+	go broker.Serve()
+	defer broker.Close()
+
+	dial := func() (net.Conn, *json.Encoder) {
+		conn, errDial := net.Dial("unix", broker.Addr().String())
+		if errDial != nil {
+			t.Fatal(errDial)
+		}
+		return conn, json.NewEncoder(conn)
+	}
+
+	// subscribed, never reads
+	slow, slowEncoder := dial()
+	defer slow.Close()
+	if err = slowEncoder.Encode(&brokerFrame{Op: "sub", Topic: "room:lobby"}); err != nil {
+		t.Fatal(err)
+	}
+
+	publisher, encoder := dial()
+	defer publisher.Close()
+	content, _ := json.Marshal(strings.Repeat("x", 64*1024))
+
+	connected := func() int {
+		broker.mutex.RLock()
+		defer broker.mutex.RUnlock()
+		return len(broker.conns)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for connected() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("PubSubBroker.Serve() | timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for {
+		if err = encoder.Encode(&brokerFrame{Op: "pub", Topic: "room:lobby", Content: content}); err != nil {
+			t.Fatalf("PubSubBroker.handle() | the publisher must not be blocked by a slow instance\n   actual: %v", err)
+		}
+		conns := connected()
+		if conns == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("PubSubBroker.handle() | the slow instance must be dropped\n   actual: %d connections", conns)
+		}
+	}
+}
@@ -1,23 +1,21 @@
 package syntax
 
 import (
-	"fmt"
 	"github.com/syntax-framework/chain"
 	"github.com/syntax-framework/chain/middlewares/session"
 	"github.com/syntax-framework/shtml/cmn"
 	"github.com/syntax-framework/shtml/sht"
 	"log"
-	"math/rand"
 	"net/http"
-	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // syntaxValidBase64Regex "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
-var syntaxValidBase64Regex = regexp.MustCompile(`[a-zA-Z0-9\-_]+`)
+var syntaxValidBase64Regex = regexp.MustCompile(`^[a-zA-Z0-9\-_]+$`)
 
 func isBase64(name string) bool {
 	return syntaxValidBase64Regex.MatchString(name)
@@ -39,108 +37,214 @@ var errorTopicOnJoinExists = cmn.Err(
 )
 
 // Todos os Channels dentro de um Topic
-// @TODO: Mensagens persistentes
-
-// SSEEvent holds all of the event source fields
-type SSEEvent struct {
-	timestamp time.Time
-	ID        []byte
-	Data      []byte
-	Event     []byte
-	Retry     []byte
-	Comment   []byte
+// Mensagens persistentes: ver Syntax.PersistTopic (topic-log.go)
+
+// pubsubQueueSize default limit of messages waiting to be delivered to a subscriber
+const pubsubQueueSize = 1024
+
+// Subscription a callback subscribed to a topic. Each subscription has its own queue, so the messages are
+// delivered concurrently to the subscribers, but in the order in which they were published to each subscriber.
+type subscription struct {
+	id       uint64
+	topic    string
+	callback func(content interface{})
+	mutex    sync.Mutex
+	queue    []interface{}
+	limit    int
+	signal   chan struct{}
+	done     chan struct{}
 }
 
-type SSESubscription struct {
-	URL         *url.URL
-	LastEventID int
-	quit        chan *SSESubscription
-	removed     chan struct{}
-	event       chan *SSEEvent // Send message to client
+// enqueue adds the content to the queue of the subscriber. Returns false when the queue is full, the subscriber is
+// not consuming the messages
+func (s *subscription) enqueue(content interface{}) bool {
+	s.mutex.Lock()
+	if len(s.queue) >= s.limit {
+		s.mutex.Unlock()
+		return false
+	}
+	s.queue = append(s.queue, content)
+	s.mutex.Unlock()
+
+	select {
+	case s.signal <- struct{}{}:
+	default:
+		// consumer already notified
+	}
+	return true
 }
 
-func (s *SSESubscription) close() {
-	s.quit <- s
-	if s.removed != nil {
-		<-s.removed
+// consume delivers the queued messages to the callback until the subscription is canceled
+func (s *subscription) consume() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.signal:
+			for {
+				s.mutex.Lock()
+				if len(s.queue) == 0 {
+					s.mutex.Unlock()
+					break
+				}
+				content := s.queue[0]
+				s.queue[0] = nil
+				s.queue = s.queue[1:]
+				s.mutex.Unlock()
+
+				s.callback(content)
+			}
+		}
 	}
 }
 
-// Socket represents a user's connection to a specific Channel
-type Socket struct {
-	//Params  Params
-	Channel *Channel
-	request *http.Request
+// PubSubAdapter transport of the content published on the topics. Allows the content published on one Syntax
+// instance to reach the subscribers and sockets connected to other instances.
+type PubSubAdapter interface {
+	// Publish delivers the content to all subscribers of the topic
+	Publish(topic string, content interface{}) error
+	// Subscribe registers the callback to receive all content published on the topic
+	Subscribe(topic string, callback func(content interface{})) (unsubscribe func(), err error)
 }
 
-// Channel handle events from clients. Channels are the highest level abstraction for real-time communication components
-// in Syntax.
-//
-// Channels provide a means for bidirectional communication from clients that integrate with the Syntax PubSub layer
-// for soft-realtime functionality.
-type Channel struct {
-	name   string
-	onJoin map[string]ChannelOnJoinFunc
+// PubSub in-process broker, delivers the content published on a topic to all subscribers of that topic. Default
+// PubSubAdapter, used when the application runs on a single instance
+type PubSub struct {
+	QueueSize   int // limit of messages waiting to be delivered to each subscriber. Default 1024
+	mutex       sync.RWMutex
+	sequence    uint64
+	subscribers map[string]map[uint64]*subscription
 }
 
-// ChannelOnJoinFunc  Clients must join a channel to send and receive PubSub events on that channel.
-//
-// # Authorization
-//
-// Your channels must register a `OnJoin()` callback that authorizes the socket	for the given topic.
-// For example, you could check if the user is allowed to	join that particular room.
-//
-// To authorize a socket in [Channel.OnJoin()], return `nil`.
-//
-//	To refuse authorization in [Channel.OnJoin()], return `error`.
-type ChannelOnJoinFunc func(topic string, params map[string]interface{}, socket *Socket) error
-
-type ChannelOnMessageFunc func(topic string, params map[string]interface{}, socket *Socket) error
-
-// OnJoin invocado quando o client procura conectar-se a este tópico neste channel
-func (c *Channel) OnJoin(topic string, callback ChannelOnJoinFunc) error {
-	topic = strings.TrimPrefix(strings.TrimSpace(topic), ":")
-	if topic != "*" && (topic == "" || !isBase64(topic)) {
-		return errorInvalidTopicName(topic)
+// Subscribe registers the callback to receive all content published on the topic, returns the function that
+// cancels the subscription
+func (p *PubSub) Subscribe(topic string, callback func(content interface{})) (unsubscribe func(), err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.subscribers == nil {
+		p.subscribers = map[string]map[uint64]*subscription{}
 	}
 
-	if _, exist := c.onJoin[topic]; exist {
-		return errorTopicOnJoinExists(c.name, topic)
+	limit := p.QueueSize
+	if limit <= 0 {
+		limit = pubsubQueueSize
 	}
 
-	c.onJoin[topic] = callback
+	p.sequence++
+	sub := &subscription{
+		id:       p.sequence,
+		topic:    topic,
+		callback: callback,
+		limit:    limit,
+		signal:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
 
-	return nil
-}
+	if p.subscribers[topic] == nil {
+		p.subscribers[topic] = map[uint64]*subscription{}
+	}
+	p.subscribers[topic][sub.id] = sub
 
-func (c *Channel) On(event string, callback ChannelOnMessageFunc) {
+	go sub.consume()
 
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.remove(sub)
+		})
+	}, nil
 }
 
-// Channel registra um novo channel para comunicação em tempo real
-func (s *Syntax) Channel(name string) error {
-	name = strings.TrimSpace(name)
-	if name == "" || !isBase64(name) {
-		return errorInvalidChannelName(name)
+// remove cancels the subscription
+func (p *PubSub) remove(sub *subscription) {
+	p.mutex.Lock()
+	if _, exists := p.subscribers[sub.topic][sub.id]; !exists {
+		p.mutex.Unlock()
+		return
 	}
+	delete(p.subscribers[sub.topic], sub.id)
+	if len(p.subscribers[sub.topic]) == 0 {
+		delete(p.subscribers, sub.topic)
+	}
+	p.mutex.Unlock()
+	close(sub.done)
+}
 
-	channel := &Channel{
-		name: name,
+// Topics list the topics with at least one subscriber
+func (p *PubSub) Topics() []string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	var topics []string
+	for topic := range p.subscribers {
+		topics = append(topics, topic)
 	}
+	return topics
+}
 
-	println(channel)
+// Publish delivers the content to all subscribers of the topic. A subscriber whose queue is full is not consuming
+// the messages and is removed, as is done with slow live connections
+func (p *PubSub) Publish(topic string, content interface{}) error {
+	var slow []*subscription
+	p.mutex.RLock()
+	for _, sub := range p.subscribers[topic] {
+		if !sub.enqueue(content) {
+			slow = append(slow, sub)
+		}
+	}
+	p.mutex.RUnlock()
 
+	for _, sub := range slow {
+		log.Printf("[syntax] subscriber of the topic %s is not consuming messages, subscription removed", topic)
+		p.remove(sub)
+	}
 	return nil
 }
 
-// Publish publica em um canal
-func (s *Syntax) Publish(topic string, content interface{}) {
+// parseTopic validates a topic in the format `channel:topic`
+func parseTopic(topic string) (channel string, name string, err error) {
+	parts := strings.Split(strings.TrimSpace(topic), ":")
+	if len(parts) != 2 {
+		return "", "", errorInvalidTopicName(topic)
+	}
+
+	channel, name = parts[0], parts[1]
+	if channel == "" || !isBase64(channel) {
+		return "", "", errorInvalidChannelName(channel)
+	}
+	if name == "" || !isBase64(name) {
+		return "", "", errorInvalidTopicName(topic)
+	}
+	return channel, name, nil
+}
+
+// Publish publica em um tópico, no formato `channel:topic`. O conteúdo é entregue a todos os subscribers e sockets
+// conectados ao tópico
+func (s *Syntax) Publish(topic string, content interface{}) error {
+	if _, _, err := parseTopic(topic); err != nil {
+		return err
+	}
+	return s.pubsub.Publish(topic, content)
+}
 
+// Broadcast publica um evento em um tópico, no formato `channel:topic`
+func (s *Syntax) Broadcast(topic string, event string, payload interface{}) error {
+	return s.Publish(topic, &Message{Event: event, Payload: payload})
 }
 
-// Subscribe subscreve em um canal
-func (s *Syntax) Subscribe(topic string, cb func(content interface{})) {
+// Subscribe subscreve em um tópico, no formato `channel:topic`. Retorna a função que cancela a subscrição
+func (s *Syntax) Subscribe(topic string, cb func(content interface{})) (func(), error) {
+	if _, _, err := parseTopic(topic); err != nil {
+		return nil, err
+	}
+	return s.pubsub.Subscribe(topic, cb)
+}
 
+// UsePubSub defines the adapter used to transport the published content, allows multiple instances to communicate.
+// Must be called before Init, the persistent topics are subscribed on Init (see Syntax.PersistTopic)
+func (s *Syntax) UsePubSub(adapter PubSubAdapter) {
+	s.pubsub = adapter
 }
 
 // initLiveServer iniciliza a conexão viva com esse servidor. Usado para push de eventos e escuta de SSE
@@ -155,6 +259,11 @@ func (s *Syntax) initLiveServer() error {
 	}
 	endpoint = strings.TrimSuffix(endpoint, "/")
 
+	keepAliveInterval := time.Duration(s.Config.LiveKeepAlive) * time.Second
+	if keepAliveInterval <= 0 {
+		keepAliveInterval = 15 * time.Second
+	}
+
 	// add stx.js asset, required on all pages
 	asset, err := s.Template.(*sht.TemplateSystem).RegisterAssetJsFilepath("/assets/js/stx.js")
 	if err != nil {
@@ -166,9 +275,20 @@ func (s *Syntax) initLiveServer() error {
 	asset.Attributes = map[string]string{
 		"data-endpoint": endpoint,
 	}
+	if transport := strings.TrimSpace(s.Config.LiveTransport); transport != "" {
+		asset.Attributes["data-transport"] = transport
+	}
 
 	// <script src="./../assets/js/stx.js" priority="100"></script>
 
+	// the steps that can fail before the routes, a failed Init can be called again
+	if err = s.initLiveControllers(); err != nil {
+		return err
+	}
+
+	s.sseHub = newSSEHub()
+	go s.sseHub.run()
+
 	// Client conecta-se ao SSE e servidor salva client em uma list, quando cliente desconectar, remove-o
 	// Client recebe mensagens via SSE
 	// Client informa tópicos que deseja ouvir
@@ -181,87 +301,39 @@ func (s *Syntax) initLiveServer() error {
 	// close conn.channel
 	// conn.client = nil
 
-	s.Use(endpoint, &session.Manager{
-		Config: session.Config{
-			Key:  "_ls",
-			Path: endpoint,
-			//Domain:     "",
-			//Expires:    time.Time{},
-			//RawExpires: "",
-			//MaxAge:     0,
-			//Secure:     false,
-			//HttpOnly:   false,
-			//SameSite:   0,
-			//Raw:        "",
-			//Unparsed:   nil,
-		},
-		Store: &session.Cookie{
-			CryptoOptions: session.CryptoOptions{
-				SecretKeyBase:  "REMOVER DEPOIS COLOCADO APENAS PARA TESTE",
-				EncryptionSalt: "",
-				SigningSalt:    "REMOVER DEPOIS COLOCADO APENAS PARA TESTE",
-				//Iterations:     0,
-				//Length:         0,
-				//Digest:         "",
+	if secret := s.Config.SecretKeyBase; secret != "" {
+		// signed with the SecretKeyBase, see initSecretKeyBase. The connection works without session
+		s.Use(endpoint, &session.Manager{
+			Config: session.Config{
+				Key:      "_ls",
+				Path:     endpoint,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
 			},
-			//Serializer:      nil,
-			//Log:             "",
-			//RotatingOptions: nil,
-		},
-	})
-
-	s.POST(endpoint, func(ctx *chain.Context) {
-		// @TODO: Parse user command
-		filepath := ctx.GetParam("filepath")
-
-		sess, _ := session.Fetch(ctx)
-		println(sess.Get("user"))
-
-		//decoder := json.NewDecoder(req.Body)
-		//var t test_struct
-		//err := decoder.Decode(&t)
-		//if err != nil {
-		//  panic(err)
-		//}
-		//log.Println(t.Test)
-
-		println(filepath)
-	})
-
-	var messageChan chan string
-
-	go func() {
-		for {
-			//b := []byte(time.Now().Format(time.RFC3339))
-			//if err := nc.Notify(b); err != nil {
-			//	log.Fatal(err)
-			//}
-
-			if messageChan != nil {
-				log.Printf("print message to client")
-				// send the message through the available channel
-				messageChan <- sht.HashMD5(time.Now().String())
-			}
+			Store: &session.Cookie{
+				CryptoOptions: session.CryptoOptions{
+					SecretKeyBase: secret,
+					SigningSalt:   "stx live session",
+				},
+			},
+		})
+	}
 
-			time.Sleep(1 * time.Second)
-		}
-	}()
+	// Client submits commands via POST, or via the WebSocket when using this transport
+	s.POST(endpoint, s.handleLiveCommand)
 
 	s.GET(endpoint, func(ctx *chain.Context) {
 		w := ctx.Writer.(*chain.ResponseWriterSpy)
+		// the sockets keep the request, see Socket.Request
 		r := ctx.Request
 
-		flusher, ok := w.ResponseWriter.(http.Flusher)
-		if !ok {
-			http.Error(w, "Connection does not support streaming", http.StatusBadRequest)
-			return
-		}
-
-		sess, _ := session.Fetch(ctx)
-		sess.Put("user", "test")
-
 		lastEventId := 0
-		if id := r.Header.Get("Last-Event-ID"); id != "" {
+		// browsers can't set headers on WebSockets, the client informs the id in the query
+		id := r.Header.Get("Last-Event-ID")
+		if id == "" {
+			id = r.URL.Query().Get("lastEventId")
+		}
+		if id != "" {
 			var err error
 			if lastEventId, err = strconv.Atoi(id); err != nil {
 				http.Error(w, "Last-Event-ID must be a number!", http.StatusBadRequest)
@@ -269,89 +341,53 @@ func (s *Syntax) initLiveServer() error {
 			}
 		}
 
+		if isWebSocketUpgrade(r) {
+			s.serveLiveWebSocket(w.ResponseWriter, r, lastEventId, keepAliveInterval)
+			return
+		}
+
+		flusher, ok := w.ResponseWriter.(http.Flusher)
+		if !ok {
+			http.Error(w, "Connection does not support streaming", http.StatusBadRequest)
+			return
+		}
+
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		//w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
-		//client := &liveReloadClient{
-		//	addr:   r.RemoteAddr,
-		//	events: make(chan *liveReloadEvent, 10),
-		//}
-		//go updateClient(client)
-
-		sub := &SSESubscription{
-			LastEventID: lastEventId,
-			URL:         r.URL,
-			//quit:        str.deregister,
-			//Connection:  make(chan *Event, 64),
-		}
-
-		go func() {
-			// Received Browser Disconnection
-			<-r.Context().Done()
-			sub.close()
-		}()
+		sub := s.sseHub.subscribe(r, lastEventId)
+		defer sub.close()
 
 		w.WriteHeader(http.StatusOK)
 		flusher.Flush()
 
-		messageChan = make(chan string)
-		defer func() {
-			close(messageChan)
-			messageChan = nil
-		}()
-
-		// test
-		//timeout := time.After(5 * time.Second)
+		encoder := newSSEEncoder(w)
+		keepAlive := time.NewTicker(keepAliveInterval)
+		defer keepAlive.Stop()
 
 		// trap the request under loop forever
 		for {
 			select {
-			case message := <-messageChan:
-				fmt.Fprintf(w, "data: \"%s\"\n\n", message)
+			case event := <-sub.event:
+				if err := encoder.Encode(event); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-keepAlive.C:
+				if err := encoder.KeepAlive(); err != nil {
+					return
+				}
 				flusher.Flush()
+			case <-sub.removed:
+				return
 			case <-r.Context().Done():
+				// Received Browser Disconnection
 				return
 			}
 		}
-
-		//select {
-		//case ev := <-client.events:
-		//	var buf bytes.Buffer
-		//	enc := json.NewEncoder(&buf)
-		//	enc.Encode(ev)
-		//	fmt.Fprintf(w, "event: xpto\ndata: %v\n\n", buf.String())
-		//case <-timeout:
-		//	fmt.Fprintf(w, ": nothing to sent\n\n")
-		//}
-		//flusher.Flush()
-
-		//ctx := r.Context()
-		//
-		//ch := make(chan struct{})
-		//
-		//go func() {
-		//  time.Sleep(5 * time.Second)
-		//  fmt.Fprintln(w, "Hello World!")
-		//  ch <- struct{}{}
-		//}()
-		//
-		//select {
-		//case <-ch:
-		//case <-ctx.Done():
-		//  http.Error(w, ctx.Err().Error(), http.StatusPartialContent)
-		//  someCleanUP()
-		//}
 	})
 	return nil
 }
-
-func updateClient(client *liveReloadClient) {
-	for {
-		client.events <- &liveReloadEvent{
-			EventType: uint(rand.Uint32()),
-		}
-	}
-}
@@ -0,0 +1,191 @@
+package syntax
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func Test_PubSub_Publish(t *testing.T) {
+	pubsub := &PubSub{}
+
+	received := make(chan interface{}, 10)
+	unsubscribe, err := pubsub.Subscribe("room:lobby", func(content interface{}) {
+		received <- content
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubsub.Publish("room:lobby", 1)
+	pubsub.Publish("room:other", 2)
+	pubsub.Publish("room:lobby", 3)
+
+	for _, expected := range []int{1, 3} {
+		select {
+		case actual := <-received:
+			if actual != expected {
+				t.Errorf("PubSub.Publish(topic, content) | invalid output\n   actual: %v\n expected: %v", actual, expected)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("PubSub.Publish(topic, content) | timeout\n expected: %v", expected)
+		}
+	}
+
+	unsubscribe()
+	pubsub.Publish("room:lobby", 4)
+
+	select {
+	case actual := <-received:
+		t.Errorf("PubSub.Publish(topic, content) | received after unsubscribe\n   actual: %v", actual)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func Test_Syntax_Publish_Socket(t *testing.T) {
+	s := &Syntax{pubsub: &PubSub{}, channels: map[string]*Channel{}, sseReplay: newSSEReplay(0, 0)}
+
+	channel, err := s.Channel("room")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.Channel("room"); err == nil {
+		t.Errorf("Syntax.Channel(name) | expected error on duplicated channel")
+	}
+
+	conn := &testSocketConn{events: make(chan *SSEEvent, 10)}
+	socket := &Socket{Channel: channel, conn: conn}
+	channel.join("lobby", socket)
+
+	if err = s.Broadcast("room:lobby", "new_msg", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-conn.events:
+		message := &Message{}
+		if err = json.Unmarshal(event.Data, message); err != nil {
+			t.Fatal(err)
+		}
+		if len(event.ID) == 0 || string(event.Event) != "room:lobby" {
+			t.Errorf("Syntax.Broadcast(topic, event, payload) | invalid event\n   actual: %+v", event)
+		}
+		if message.Channel != "room" || message.Topic != "lobby" || message.Event != "new_msg" || message.Payload != "hello" {
+			t.Errorf("Syntax.Broadcast(topic, event, payload) | invalid output\n   actual: %+v", message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Syntax.Broadcast(topic, event, payload) | timeout")
+	}
+
+	if err = s.Publish("room", "invalid"); err == nil {
+		t.Errorf("Syntax.Publish(topic, content) | expected error on invalid topic")
+	}
+}
+
+func Test_Channel_Replay(t *testing.T) {
+	s := &Syntax{pubsub: &PubSub{}, channels: map[string]*Channel{}, sseReplay: newSSEReplay(2, time.Minute)}
+
+	channel, err := s.Channel("room")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i, data := range []string{"a", "b", "c"} {
+		s.sseReplay.record("room:lobby", &SSEEvent{timestamp: now.Add(time.Duration(i) * time.Millisecond), Data: []byte(data)})
+	}
+
+	events, ok := s.sseReplay.since("room:lobby", int(now.UnixMicro()))
+	if !ok || len(events) != 2 || string(events[0].Data) != "b" || string(events[1].Data) != "c" {
+		t.Errorf("sseReplay.since(topic, id) | invalid output\n   actual: %d events, %v\n expected: [b c]", len(events), ok)
+	}
+
+	// id of the first event, already discarded
+	conn := &testSocketConn{events: make(chan *SSEEvent, 10), last: int(now.UnixMicro()) - 1}
+	channel.join("lobby", &Socket{Channel: channel, conn: conn})
+
+	message := &Message{}
+	if err = json.Unmarshal((<-conn.events).Data, message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Event != "reset" {
+		t.Errorf("Channel.join(topic, socket) | invalid output\n   actual: %s\n expected: reset", message.Event)
+	}
+}
+
+type testSocketConn struct {
+	events chan *SSEEvent
+	last   int
+}
+
+func (c *testSocketConn) send(event *SSEEvent) bool {
+	c.events <- event
+	return true
+}
+
+func (c *testSocketConn) lastEventID() int {
+	return c.last
+}
+
+func Test_PubSub_Slow_Subscriber(t *testing.T) {
+	pubsub := &PubSub{QueueSize: 2}
+
+	block := make(chan struct{})
+	received := make(chan interface{}, 10)
+	if _, err := pubsub.Subscribe("room:lobby", func(content interface{}) {
+		<-block
+		received <- content
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first message is taken by the consumer, the others fill the queue
+	for i := 1; i <= 10; i++ {
+		pubsub.Publish("room:lobby", i)
+	}
+	close(block)
+
+	if topics := pubsub.Topics(); len(topics) != 0 {
+		t.Errorf("PubSub.Publish(topic, content) | the slow subscriber must be removed\n   actual: %v", topics)
+	}
+	pubsub.Publish("room:lobby", 11)
+
+	count := 0
+	timeout := time.After(100 * time.Millisecond)
+	for {
+		select {
+		case content := <-received:
+			if content == 11 {
+				t.Errorf("PubSub.Publish(topic, content) | received after removal")
+			}
+			count++
+			continue
+		case <-timeout:
+		}
+		break
+	}
+	if count > 3 {
+		t.Errorf("PubSub.Publish(topic, content) | the queue must be limited\n   actual: %d", count)
+	}
+}
+
+func Test_Parse_Topic(t *testing.T) {
+	tests := []struct {
+		topic string
+		valid bool
+	}{
+		{"room:lobby", true},
+		{"stx_live:AnqjyGGnvyUhpayI7IsH-Q", true},
+		{"room:lob by", false},
+		{"room:lobby!", false},
+		{"ro/om:lobby", false},
+		{"room:", false},
+		{"room", false},
+	}
+	for _, tt := range tests {
+		if _, _, err := parseTopic(tt.topic); (err == nil) != tt.valid {
+			t.Errorf("parseTopic(topic) | invalid output %s\n   actual: %v\n expected: %v", tt.topic, err, tt.valid)
+		}
+	}
+}
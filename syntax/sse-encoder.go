@@ -0,0 +1,90 @@
+package syntax
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// sseEncoder writes events in the EventSource format
+//
+// https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation
+type sseEncoder struct {
+	w *bufio.Writer
+}
+
+func newSSEEncoder(w io.Writer) *sseEncoder {
+	return &sseEncoder{w: bufio.NewWriter(w)}
+}
+
+// Encode writes the event to the stream. Multi-line fields are split into multiple lines of the same field, fields
+// that cannot contain line breaks (id, event and retry) have them removed
+func (e *sseEncoder) Encode(event *SSEEvent) error {
+	if len(event.Comment) > 0 {
+		for _, line := range sseSplitLines(event.Comment) {
+			e.writeField("", line)
+		}
+	}
+
+	if len(event.ID) > 0 {
+		// the id field cannot contain NULL
+		e.writeField("id", bytes.ReplaceAll(sseSingleLine(event.ID), []byte{0}, nil))
+	}
+
+	if len(event.Event) > 0 {
+		e.writeField("event", sseSingleLine(event.Event))
+	}
+
+	if len(event.Retry) > 0 {
+		// retry is only accepted by the client if it consists of ASCII digits
+		if retry := sseSingleLine(event.Retry); isASCIIDigits(retry) {
+			e.writeField("retry", retry)
+		}
+	}
+
+	if event.Data != nil {
+		for _, line := range sseSplitLines(event.Data) {
+			e.writeField("data", line)
+		}
+	}
+
+	e.w.WriteByte('\n')
+	return e.w.Flush()
+}
+
+// KeepAlive writes an empty comment, prevents proxies from closing idle connections
+func (e *sseEncoder) KeepAlive() error {
+	e.w.WriteString(":\n\n")
+	return e.w.Flush()
+}
+
+func (e *sseEncoder) writeField(name string, value []byte) {
+	e.w.WriteString(name)
+	e.w.WriteByte(':')
+	if len(value) > 0 {
+		e.w.WriteByte(' ')
+		e.w.Write(value)
+	}
+	e.w.WriteByte('\n')
+}
+
+// sseSplitLines splits the content on CRLF, LF or CR
+func sseSplitLines(content []byte) [][]byte {
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	content = bytes.ReplaceAll(content, []byte("\r"), []byte("\n"))
+	return bytes.Split(content, []byte("\n"))
+}
+
+// sseSingleLine removes the line breaks of the content
+func sseSingleLine(content []byte) []byte {
+	return bytes.Join(sseSplitLines(content), nil)
+}
+
+func isASCIIDigits(content []byte) bool {
+	for _, c := range content {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return len(content) > 0
+}
@@ -0,0 +1,157 @@
+package syntax
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// parsedSSEEvent an event dispatched by the reference parser
+type parsedSSEEvent struct {
+	id    string
+	event string
+	data  string
+	retry string
+}
+
+// parseSSEStream reference parser, implements the event stream interpretation of the WHATWG specification
+//
+// https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation
+func parseSSEStream(t *testing.T, stream string) (events []parsedSSEEvent, comments []string) {
+	scanner := bufio.NewScanner(strings.NewReader(stream))
+	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+			if data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			t.Errorf("parseSSEStream | stream must end with a line break\n   actual: %q", data)
+			return len(data), nil, nil
+		}
+		return 0, nil, nil
+	})
+
+	var id, retry string
+	var eventType string
+	var data []string
+	hasData := false
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// dispatch, the last event id is kept between events
+			if hasData {
+				events = append(events, parsedSSEEvent{id: id, event: eventType, data: strings.Join(data, "\n"), retry: retry})
+			}
+			eventType, data, hasData, retry = "", nil, false, ""
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			comments = append(comments, strings.TrimPrefix(strings.TrimPrefix(line, ":"), " "))
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data = append(data, value)
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				id = value
+			}
+		case "retry":
+			retry = value
+		default:
+			t.Errorf("parseSSEStream | unknown field\n   actual: %q", field)
+		}
+	}
+	return
+}
+
+func Test_SSE_Encoder(t *testing.T) {
+
+	tests := []struct {
+		event    *SSEEvent
+		expected parsedSSEEvent
+	}{
+		{
+			&SSEEvent{Data: []byte("simple")},
+			parsedSSEEvent{data: "simple"},
+		},
+		{
+			&SSEEvent{ID: []byte("42"), Event: []byte("room:lobby"), Data: []byte(`{"a":1}`), Retry: []byte("3000")},
+			parsedSSEEvent{id: "42", event: "room:lobby", data: `{"a":1}`, retry: "3000"},
+		},
+		{
+			&SSEEvent{Data: []byte("line 1\nline 2\r\nline 3\rline 4")},
+			parsedSSEEvent{id: "42", data: "line 1\nline 2\nline 3\nline 4"},
+		},
+		{
+			&SSEEvent{Data: []byte(" leading space\n\ntrailing empty\n")},
+			parsedSSEEvent{id: "42", data: " leading space\n\ntrailing empty\n"},
+		},
+		{
+			&SSEEvent{Data: []byte("data: injected\n\nevent: fake")},
+			parsedSSEEvent{id: "42", data: "data: injected\n\nevent: fake"},
+		},
+		{
+			&SSEEvent{ID: []byte("1\n2"), Event: []byte("multi\nline"), Data: []byte("x"), Retry: []byte("abc")},
+			parsedSSEEvent{id: "12", event: "multiline", data: "x"},
+		},
+		{
+			&SSEEvent{Data: []byte("")},
+			parsedSSEEvent{id: "12", data: ""},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := newSSEEncoder(buf)
+	for _, test := range tests {
+		if err := encoder.Encode(test.event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, _ := parseSSEStream(t, buf.String())
+	if len(events) != len(tests) {
+		t.Fatalf("sseEncoder.Encode(event) | invalid number of events\n   actual: %d\n expected: %d", len(events), len(tests))
+	}
+	for i, test := range tests {
+		if events[i] != test.expected {
+			t.Errorf("sseEncoder.Encode(event) | invalid output\n   actual: %+v\n expected: %+v", events[i], test.expected)
+		}
+	}
+}
+
+func Test_SSE_Encoder_Comments(t *testing.T) {
+	buf := &bytes.Buffer{}
+	encoder := newSSEEncoder(buf)
+
+	if err := encoder.Encode(&SSEEvent{Comment: []byte("first\nsecond")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.KeepAlive(); err != nil {
+		t.Fatal(err)
+	}
+
+	events, comments := parseSSEStream(t, buf.String())
+	if len(events) != 0 {
+		t.Errorf("sseEncoder.Encode(comment) | comments must not dispatch events\n   actual: %+v", events)
+	}
+
+	expected := []string{"first", "second", ""}
+	if strings.Join(comments, "|") != strings.Join(expected, "|") {
+		t.Errorf("sseEncoder.Encode(comment) | invalid output\n   actual: %q\n expected: %q", comments, expected)
+	}
+}
@@ -0,0 +1,186 @@
+package syntax
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const sseReplayDefaultSize = 100
+const sseReplayDefaultAge = 5 * time.Minute
+
+// sseReplayBuffer bounded ring buffer with the most recent events of a topic, used to replay the events lost by a
+// client that reconnects informing the `Last-Event-ID`
+type sseReplayBuffer struct {
+	mutex     sync.Mutex
+	maxSize   int
+	maxAge    time.Duration
+	events    []*SSEEvent
+	ids       []int
+	start     int // index of the oldest event
+	count     int
+	evictedID int // id of the last event removed from the buffer
+}
+
+func newSSEReplayBuffer(maxSize int, maxAge time.Duration) *sseReplayBuffer {
+	return &sseReplayBuffer{
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		events:  make([]*SSEEvent, maxSize),
+		ids:     make([]int, maxSize),
+	}
+}
+
+// add appends an event to the buffer, the oldest event is discarded when the buffer is full
+func (b *sseReplayBuffer) add(id int, event *SSEEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.expire(event.timestamp)
+
+	if b.count == b.maxSize {
+		b.evict()
+	}
+	index := (b.start + b.count) % b.maxSize
+	b.events[index] = event
+	b.ids[index] = id
+	b.count++
+}
+
+// since returns, in order, all events after the given id. Returns false when events after that id have already been
+// discarded, in which case the client must reset its state.
+func (b *sseReplayBuffer) since(id int) ([]*SSEEvent, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.expire(time.Now())
+
+	if b.evictedID > id {
+		return nil, false
+	}
+
+	var events []*SSEEvent
+	for i := 0; i < b.count; i++ {
+		index := (b.start + i) % b.maxSize
+		if b.ids[index] > id {
+			events = append(events, b.events[index])
+		}
+	}
+	return events, true
+}
+
+// empty checks if all events in the buffer have expired
+func (b *sseReplayBuffer) empty() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.expire(time.Now())
+	return b.count == 0
+}
+
+// expire removes events older than maxAge
+func (b *sseReplayBuffer) expire(now time.Time) {
+	limit := now.Add(-b.maxAge)
+	for b.count > 0 && b.events[b.start].timestamp.Before(limit) {
+		b.evict()
+	}
+}
+
+// evict removes the oldest event
+func (b *sseReplayBuffer) evict() {
+	b.evictedID = b.ids[b.start]
+	b.events[b.start] = nil
+	b.start = (b.start + 1) % b.maxSize
+	b.count--
+}
+
+// sseReplay the replay buffers of all topics of this server
+type sseReplay struct {
+	mutex     sync.Mutex
+	maxSize   int
+	maxAge    time.Duration
+	lastID    int
+	buffers   map[string]*sseReplayBuffer
+	lastPrune time.Time
+}
+
+func newSSEReplay(maxSize int, maxAge time.Duration) *sseReplay {
+	if maxSize <= 0 {
+		maxSize = sseReplayDefaultSize
+	}
+	if maxAge <= 0 {
+		maxAge = sseReplayDefaultAge
+	}
+	return &sseReplay{
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		buffers: map[string]*sseReplayBuffer{},
+	}
+}
+
+// record assigns a new id to the event and keeps it in the topic buffer. Events that already have an id (persistent
+// topics) keep it.
+//
+// Ids are based on the clock, in microseconds, so they remain increasing even after a server restart.
+func (r *sseReplay) record(topic string, event *SSEEvent) {
+	r.mutex.Lock()
+	id := nextEventID(event.timestamp, r.lastID)
+	if len(event.ID) > 0 {
+		if eventID, err := strconv.Atoi(string(event.ID)); err == nil {
+			id = eventID
+		}
+	}
+	if id > r.lastID {
+		r.lastID = id
+	}
+
+	r.prune(event.timestamp)
+	buffer, exists := r.buffers[topic]
+	if !exists {
+		buffer = newSSEReplayBuffer(r.maxSize, r.maxAge)
+		r.buffers[topic] = buffer
+	}
+	event.ID = []byte(strconv.Itoa(id))
+	buffer.add(id, event)
+	r.mutex.Unlock()
+}
+
+// nextEventID the id of an event created at the given time, always greater than the last id
+func nextEventID(timestamp time.Time, lastID int) int {
+	id := int(timestamp.UnixMicro())
+	if id <= lastID {
+		id = lastID + 1
+	}
+	return id
+}
+
+// since returns the events of the topic after the given id
+func (r *sseReplay) since(topic string, id int) ([]*SSEEvent, bool) {
+	r.mutex.Lock()
+	buffer, exists := r.buffers[topic]
+	r.mutex.Unlock()
+
+	if !exists {
+		// nothing was published recently on this topic, there is no way to know if the client has lost events
+		return nil, id >= r.oldestKnownID()
+	}
+	return buffer.since(id)
+}
+
+// oldestKnownID the id of the oldest event that could still be present in the buffers
+func (r *sseReplay) oldestKnownID() int {
+	return int(time.Now().Add(-r.maxAge).UnixMicro())
+}
+
+// prune removes, at most once per minute, buffers whose events have all expired
+func (r *sseReplay) prune(now time.Time) {
+	if now.Sub(r.lastPrune) < time.Minute {
+		return
+	}
+	r.lastPrune = now
+	for topic, buffer := range r.buffers {
+		if buffer.empty() {
+			delete(r.buffers, topic)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package syntax
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/syntax-framework/shtml/sht"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var sseSubscriptionIDSeq = &sht.Sequence{Salt: time.Now().String()}
+
+// SSEEvent holds all of the event source fields
+type SSEEvent struct {
+	timestamp time.Time
+	ID        []byte
+	Data      []byte
+	Event     []byte
+	Retry     []byte
+	Comment   []byte
+}
+
+// SSESubscription a browser connected to the live endpoint. Each subscription has its own event queue.
+type SSESubscription struct {
+	ID          string
+	token       string // secret of the connection, only the client that owns it can send commands
+	URL         *url.URL
+	LastEventID int
+	request     *http.Request
+	quit        chan *SSESubscription
+	removed     chan struct{}
+	event       chan *SSEEvent // Send message to client
+	mutex       sync.Mutex
+	sockets     map[string]*Socket // by channel name
+	overflow    sync.Once
+}
+
+// close deregisters the subscription from the hub and waits for its removal. All sockets of the connection leave
+// their topics
+func (s *SSESubscription) close() {
+	s.quit <- s
+	if s.removed != nil {
+		<-s.removed
+	}
+
+	s.mutex.Lock()
+	var sockets []*Socket
+	for _, socket := range s.sockets {
+		sockets = append(sockets, socket)
+	}
+	s.mutex.Unlock()
+
+	for _, socket := range sockets {
+		socket.leaveAll()
+	}
+}
+
+// send queues an event to be sent to the client. Returns false if the subscription has already been removed or if
+// the client is not consuming the events. A slow client is disconnected, on reconnection it receives the missed
+// events from the replay buffer (Last-Event-ID)
+func (s *SSESubscription) send(event *SSEEvent) bool {
+	select {
+	case <-s.removed:
+		return false
+	default:
+	}
+
+	select {
+	case s.event <- event:
+		return true
+	case <-s.removed:
+		return false
+	default:
+		s.overflow.Do(func() {
+			log.Printf("[syntax] live connection %s is not consuming events, connection closed", s.ID)
+			// the request loop ends when the hub removes the subscription
+			go func() { s.quit <- s }()
+		})
+		return false
+	}
+}
+
+// lastEventID the `Last-Event-ID` informed by the client when connecting
+func (s *SSESubscription) lastEventID() int {
+	return s.LastEventID
+}
+
+// socket gets the socket of this connection for the channel
+func (s *SSESubscription) socket(channel *Channel) *Socket {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	socket, exists := s.sockets[channel.name]
+	if !exists {
+		socket = &Socket{
+			ID:      s.ID,
+			Channel: channel,
+			request: s.request,
+			conn:    s,
+		}
+		s.sockets[channel.name] = socket
+	}
+	return socket
+}
+
+// sseHub keeps the record of all browsers connected to the live endpoint of this server
+type sseHub struct {
+	register      chan *SSESubscription
+	deregister    chan *SSESubscription
+	mutex         sync.RWMutex
+	subscriptions map[string]*SSESubscription
+}
+
+func newSSEHub() *sseHub {
+	return &sseHub{
+		register:      make(chan *SSESubscription),
+		deregister:    make(chan *SSESubscription),
+		subscriptions: map[string]*SSESubscription{},
+	}
+}
+
+// run processes the registration and removal of subscriptions
+func (h *sseHub) run() {
+	for {
+		select {
+		case sub := <-h.register:
+			h.mutex.Lock()
+			h.subscriptions[sub.ID] = sub
+			h.mutex.Unlock()
+
+		case sub := <-h.deregister:
+			h.mutex.Lock()
+			if _, exists := h.subscriptions[sub.ID]; exists {
+				delete(h.subscriptions, sub.ID)
+				close(sub.removed)
+			}
+			h.mutex.Unlock()
+		}
+	}
+}
+
+// subscribe creates and registers a new subscription, the client is informed of the id and the token of its
+// connection
+func (h *sseHub) subscribe(r *http.Request, lastEventID int) *SSESubscription {
+	sub := &SSESubscription{
+		ID:          newSubscriptionID(),
+		token:       newSubscriptionID(),
+		URL:         r.URL,
+		LastEventID: lastEventID,
+		request:     r,
+		quit:        h.deregister,
+		removed:     make(chan struct{}),
+		event:       make(chan *SSEEvent, 64),
+		sockets:     map[string]*Socket{},
+	}
+	h.register <- sub
+
+	sub.send(&SSEEvent{
+		timestamp: time.Now(),
+		Event:     []byte(eventConnection),
+		Data:      []byte(`{"id":"` + sub.ID + `","token":"` + sub.token + `"}`),
+	})
+	return sub
+}
+
+// get obtains a subscription by id
+func (h *sseHub) get(id string) *SSESubscription {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.subscriptions[id]
+}
+
+// newSubscriptionID generates a random identifier for a live connection
+func newSubscriptionID() string {
+	bytes := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, bytes); err != nil {
+		return sht.HashXXH64Hex(sseSubscriptionIDSeq.NextHash() + time.Now().String())
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
@@ -0,0 +1,67 @@
+package syntax
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_SSEHub_Register(t *testing.T) {
+	hub := newSSEHub()
+	go hub.run()
+
+	sub := hub.subscribe(httptest.NewRequest("GET", "/live", nil), 7)
+	if hub.get(sub.ID) != sub {
+		t.Fatalf("sseHub.subscribe(r) | subscription must be registered")
+	}
+	if sub.lastEventID() != 7 {
+		t.Errorf("sseHub.subscribe(r) | invalid Last-Event-ID\n   actual: %d\n expected: 7", sub.lastEventID())
+	}
+
+	select {
+	case event := <-sub.event:
+		if string(event.Event) != eventConnection || string(event.Data) != `{"id":"`+sub.ID+`","token":"`+sub.token+`"}` {
+			t.Errorf("sseHub.subscribe(r) | invalid connection event\n   actual: %s %s", event.Event, event.Data)
+		}
+	default:
+		t.Errorf("sseHub.subscribe(r) | the client must be informed of the id of its connection")
+	}
+
+	other := hub.subscribe(httptest.NewRequest("GET", "/live", nil), 0)
+	if other.ID == sub.ID || other.token == sub.token || sub.token == sub.ID {
+		t.Errorf("sseHub.subscribe(r) | the ids and tokens must be unique")
+	}
+
+	sub.close()
+	if hub.get(sub.ID) != nil {
+		t.Errorf("SSESubscription.close() | subscription must be deregistered")
+	}
+	if sub.send(&SSEEvent{Data: []byte("x")}) {
+		t.Errorf("SSESubscription.send(event) | must not send after removal")
+	}
+	if hub.get(other.ID) != other {
+		t.Errorf("SSESubscription.close() | the other subscriptions must be kept")
+	}
+
+	// closing twice is harmless
+	sub.close()
+}
+
+func Test_SSEHub_Slow_Client(t *testing.T) {
+	hub := newSSEHub()
+	go hub.run()
+
+	sub := hub.subscribe(httptest.NewRequest("GET", "/live", nil), 0)
+	for i := 0; i <= cap(sub.event); i++ {
+		sub.send(&SSEEvent{Data: []byte("x")})
+	}
+
+	select {
+	case <-sub.removed:
+	case <-time.After(time.Second):
+		t.Fatal("SSESubscription.send(event) | the slow client must be disconnected")
+	}
+	if hub.get(sub.ID) != nil {
+		t.Errorf("SSESubscription.send(event) | subscription must be deregistered")
+	}
+}
@@ -5,9 +5,9 @@
   const interval = Number.parseInt(dataset.interval);
   const reloadPageOnCss = dataset.reloadPageOnCss === 'true';
 
-  function buildFreshUrl(link) {
+  function buildFreshUrl(link, asset) {
     const date = Math.round(Date.now() / 1000).toString();
-    const url = link.href.replace(/(\&|\\?)vsn=\d*/, '');
+    const url = link.href.replace(/(\&|\\?)vsn=\w*/, '');
     const newLink = document.createElement('link');
     const onComplete = function () {
       if (link.parentNode !== null) {
@@ -20,7 +20,16 @@
     link.setAttribute('data-pending-removal', '');
     newLink.setAttribute('rel', 'stylesheet');
     newLink.setAttribute('type', 'text/css');
-    newLink.setAttribute('href', url + (url.indexOf('?') >= 0 ? '&' : '?') + 'vsn=' + date);
+    if (asset) {
+      // the server informs the new fingerprint of the stylesheet
+      newLink.setAttribute('href', asset.href);
+      newLink.setAttribute('data-asset', asset.name);
+      if (asset.integrity) {
+        newLink.setAttribute('integrity', asset.integrity);
+      }
+    } else {
+      newLink.setAttribute('href', url + (url.indexOf('?') >= 0 ? '&' : '?') + 'vsn=' + date);
+    }
     link.parentNode.insertBefore(newLink, link.nextSibling);
 
     return newLink;
@@ -34,8 +43,22 @@
     }
   }
 
-  function cssStrategy() {
+  function cssStrategy(msg) {
     let selectors = 'link[rel=stylesheet]:not([data-no-reload]):not([data-pending-removal])';
+    if (msg.assets && msg.assets.length > 0) {
+      // replaces only the changed stylesheets, see Bundler.GetStyles
+      msg.assets.forEach(function (asset) {
+        const selector = selectors + '[data-asset="' + (asset.previous || asset.name) + '"]';
+        [].slice
+          .call(window.parent.document.querySelectorAll(selector))
+          .forEach(function (link) {
+            buildFreshUrl(link, asset)
+          });
+      });
+      repaint();
+      return;
+    }
+
     [].slice
       .call(window.parent.document.querySelectorAll(selectors))
       .filter(function (link) {
@@ -60,14 +83,13 @@
   // Use SSE
   //
   // https://developer.mozilla.org/en-US/docs/Web/API/Server-sent_events/Using_server-sent_events
-  // new EventSource(endpoint).onmessage = (event) => {
-  //   let msg = JSON.parse(event.data);
-  //   console.log("New Live Reload Event", msg)
-  //   setTimeout(function () {
-  //     // const reloadStrategy = reloadStrategies[msg.asset_type] || reloadStrategies.page;
-  //     // reloadStrategy();
-  //   }, interval);
-  // }
+  new EventSource(endpoint).onmessage = (event) => {
+    let msg = JSON.parse(event.data);
+    setTimeout(function () {
+      const reloadStrategy = reloadStrategies[msg.type] || reloadStrategies.page;
+      reloadStrategy(msg);
+    }, interval);
+  }
 
   /*
   Part of the code obtained from https://github.com/phoenixframework/phoenix_live_reload
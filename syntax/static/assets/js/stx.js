@@ -635,62 +635,84 @@
   // Single connection for entire application
   let connection
 
-  function push(payload, timeout, maxRetries = 3) {
-    let promise = new Promise((resolve, reject) => {
-      const fetchWithRetries = async (retries) => {
-        try {
-          return await fetch(serverEndpoint, {
-            method: 'POST',
-            mode: 'cors',
-            cache: 'no-cache',
-            credentials: 'same-origin',
-            headers: {
-              'Accept': 'application/json',
-              'Content-Type': 'application/json',
-            },
-            redirect: 'follow',
-            referrerPolicy: 'no-referrer',
-            body: JSON.stringify(payload)
-          });
-        } catch (error) {
+  /**
+   * Sends a command to the server by POST. Resolves when the server accepts the command, the reply arrives through
+   * the connection
+   *
+   * @param payload {Object}
+   * @param maxRetries {number}
+   * @return {Promise<Response>}
+   */
+  function push(payload, maxRetries = 3) {
+    return new Promise((resolve, reject) => {
+      const fetchWithRetries = (retries) => {
+        fetch(serverEndpoint, {
+          method: 'POST',
+          mode: 'same-origin',
+          cache: 'no-cache',
+          credentials: 'same-origin',
+          headers: {
+            'Accept': 'application/json',
+            'Content-Type': 'application/json',
+          },
+          redirect: 'follow',
+          referrerPolicy: 'no-referrer',
+          body: JSON.stringify(payload)
+        }).then((response) => {
+          if (response.ok) {
+            resolve(response)
+            return
+          }
+          // command refused by the server
+          response.text().then((reason) => reject(reason || response.statusText), () => reject(response.statusText))
+        }, (error) => {
           if (retries < maxRetries) {
-            return fetchWithRetries(retries + 1);
+            fetchWithRetries(retries + 1)
+            return
           }
           // max retries exceeded
-          throw error;
-        }
+          reject(error)
+        })
       }
-      return fetchWithRetries(0)
+      fetchWithRetries(0)
     })
-
-    // if the timeout option is specified, race the fetch call
-    if (timeout) {
-      promise = Promise.race([
-        promise,
-        new Promise((_, reject) => {
-          // throw on timeout
-          setTimeout(() => reject("TIMEOUT"), timeout)
-        })
-      ]);
-    }
-
-    return promise;
   }
 
   class Channel {
 
-    constructor(topic, params, sse) {
+    constructor(topic, params, connection) {
       this.seq = 0;
       this.topic = topic
+      this.params = params || {}
+      this.connection = connection
       this.timeout = 5000; // @TODO: from server config
       this.events = createNanoEvents()
+      this.pending = {}
+
+      const [channelName, topicName] = topic.split(':')
+      this.channelName = channelName
+      this.topicName = topicName
 
+      // messages published on this topic, `{channel, topic, event, payload, ref}`
       let listener = (e) => {
-        console.log(this, e.data)
+        let msg = JSON.parse(e.data);
+        if (msg.event === 'stx_reply') {
+          let pending = this.pending[msg.ref]
+          if (pending) {
+            delete this.pending[msg.ref]
+            if (msg.payload.status === 'ok') {
+              pending.resolve(msg.payload.response)
+            } else {
+              pending.reject(msg.payload.reason)
+            }
+          }
+          return
+        }
+        this.events.emit(msg.event, msg.payload)
       };
-      sse.addEventListener(topic, listener)
+      connection.addEventListener(topic, listener)
       this.onClose(() => {
-        sse.removeEventListener(listener)
+        connection.removeEventListener(topic, listener)
       });
     }
 
@@ -705,22 +727,57 @@
     /**
      * Sends a message `event` to syntax with the payload `payload`.
      *
-     * Syntax receives this in the `handle_in(event, payload, socket)` function. if syntax replies or it times out (default 10000ms),
-     * then optionally the reply can be received.
+     * Syntax receives this in the `Channel.On(event, callback)` function. if syntax replies or it times out (default
+     * 5000ms), then optionally the reply can be received.
      *
      * @example
      * channel.push("event")
-     *   .then(() => console.log("Submitted"))
+     *   .then((response) => console.log("Submitted", response))
      *   .catch(err => console.log("Syntax errored", err))
      *
      * @param {string} event
      * @param {Object} payload
      * @param {number} timeout
      * @param {number} maxRetries
-     * @returns {Promise<Response>}
+     * @returns {Promise<*>}
      */
     push(event, payload, timeout = this.timeout, maxRetries) {
-      return push({t: this.topic, e: event, s: this.seq++, p: payload || {}}, timeout, maxRetries)
+      const ref = String(this.seq++)
+      return this.connection.ready.then((conn) => {
+        // only the reply is limited by the timeout
+        let reply = new Promise((resolve, reject) => {
+          this.pending[ref] = {resolve, reject}
+          setTimeout(() => {
+            if (this.pending[ref]) {
+              delete this.pending[ref]
+              reject("TIMEOUT")
+            }
+          }, timeout)
+        })
+        return this.connection.send({
+          socket: conn.id,
+          token: conn.token,
+          channel: this.channelName,
+          topic: this.topicName,
+          event: event,
+          payload: payload || {},
+          ref: ref
+        }, maxRetries).then(() => reply, (reason) => {
+          delete this.pending[ref]
+          throw reason
+        })
+      })
+    }
+
+    /**
+     * Joins the topic, the server authorizes the join on `Channel.OnJoin(topic, callback)`
+     *
+     * @returns {Promise<*>}
+     */
+    join() {
+      this.joined = this.push('stx_join', this.params)
+      this.joined.catch((reason) => this.events.emit('stx_error', reason))
+      return this.joined
     }
 
     /**
@@ -730,7 +787,99 @@
      * @param timeout
      */
     close(timeout = this.timeout) {
-      // return this.events.on(event, callback);
+      let leave = this.push('stx_leave', {}, timeout)
+      this.events.emit('stx_close')
+      return leave
+    }
+  }
+
+  /**
+   * Transport using EventSource to receive the events and POST to send the commands
+   */
+  function sseTransport() {
+    // https://developer.mozilla.org/en-US/docs/Web/API/EventSource
+    let sse = new EventSource(serverEndpoint);
+
+    sse.onerror = (event) => {
+      console.log('onerror', event)
+    }
+
+    return {
+      addEventListener: (event, callback) => sse.addEventListener(event, callback),
+      removeEventListener: (event, callback) => sse.removeEventListener(event, callback),
+      send: (payload, maxRetries) => push(payload, maxRetries),
+      close: () => sse.close()
+    }
+  }
+
+  /**
+   * Transport using a single WebSocket in both directions. The server sends the same events of the SSE, as
+   * `{id, event, data}`.
+   *
+   * If the first connection can't be opened (ex. proxies that don't support WebSockets), calls the fallback.
+   *
+   * @param fallback {() => void}
+   */
+  function webSocketTransport(fallback) {
+    let events = new EventTarget()
+    let url = new URL(serverEndpoint, location.href)
+    url.protocol = url.protocol === 'https:' ? 'wss:' : 'ws:'
+
+    let ws
+    let opened = false
+    let closed = false
+    let retries = 0
+    let lastEventId = ''
+    let queue = []
+
+    function connect() {
+      if (lastEventId !== '') {
+        url.searchParams.set('lastEventId', lastEventId)
+      }
+      ws = new WebSocket(url.href)
+      ws.onopen = () => {
+        opened = true
+        retries = 0
+        queue.splice(0).forEach((data) => ws.send(data))
+      }
+      ws.onmessage = (event) => {
+        let frame = JSON.parse(event.data)
+        if (frame.id) {
+          lastEventId = frame.id
+        }
+        events.dispatchEvent(new MessageEvent(frame.event || 'message', {data: frame.data, lastEventId: lastEventId}))
+      }
+      ws.onclose = () => {
+        if (closed) {
+          return
+        }
+        if (!opened) {
+          closed = true
+          fallback()
+          return
+        }
+        setTimeout(connect, Math.min(10000, 500 * Math.pow(2, retries++)))
+      }
+    }
+
+    connect()
+
+    return {
+      addEventListener: (event, callback) => events.addEventListener(event, callback),
+      removeEventListener: (event, callback) => events.removeEventListener(event, callback),
+      send: (payload) => {
+        let data = JSON.stringify(payload)
+        if (ws.readyState === WebSocket.OPEN) {
+          ws.send(data)
+        } else {
+          queue.push(data)
+        }
+        return Promise.resolve()
+      },
+      close: () => {
+        closed = true
+        ws.close()
+      }
     }
   }
 
@@ -745,20 +894,39 @@
 
         let channels = [];
 
-        // https://developer.mozilla.org/en-US/docs/Web/API/EventSource
-        let sse = new EventSource(serverEndpoint);
-
-        sse.onmessage = (event) => {
-          let msg = JSON.parse(event.data);
-          console.log("New Live Event", msg)
+        // listeners of the channels, kept to be moved to the fallback transport
+        let listeners = [];
+
+        // id and token of the connection, `{id, token}`, informed by the server on each (re)connection
+        let setSocket
+        let ready = new Promise((resolve) => setSocket = resolve)
+        let onConnection = (event) => {
+          let socket = JSON.parse(event.data)
+          if (setSocket) {
+            setSocket(socket)
+            setSocket = null
+          } else {
+            // reconnection, the server has a new connection without members
+            ready = Promise.resolve(socket)
+            channels.forEach((channel) => channel.join())
+          }
         }
 
-        sse.onerror = (event) => {
-          console.log('onerror', event)
+        let transport
+        let useTransport = (next) => {
+          if (transport) {
+            transport.close()
+          }
+          transport = next
+          transport.addEventListener('stx_connection', onConnection)
+          listeners.forEach(([event, callback]) => transport.addEventListener(event, callback))
         }
 
-        sse.onopen = (event) => {
-          console.log('onopen', event)
+        // WebSocket when available, falling back to SSE + POST
+        if (window.WebSocket && dataset.transport !== 'sse') {
+          useTransport(webSocketTransport(() => useTransport(sseTransport())))
+        } else {
+          useTransport(sseTransport())
         }
 
         /**
@@ -778,9 +946,23 @@
             throw new Error('Invalid topic name: ' + topic)
           }
 
-          let channel = new Channel(topic, params, sse)
+          let channel = new Channel(topic, params, {
+            addEventListener: (event, callback) => {
+              listeners.push([event, callback])
+              transport.addEventListener(event, callback)
+            },
+            removeEventListener: (event, callback) => {
+              listeners = listeners.filter(([e, c]) => e !== event || c !== callback)
+              transport.removeEventListener(event, callback)
+            },
+            send: (payload, maxRetries) => transport.send(payload, maxRetries),
+            get ready() {
+              return ready
+            }
+          })
 
           channels.push(channel)
+          channel.join()
           channel.onClose(() => {
             let idx = channels.indexOf(channel);
             if (idx >= 0) {
@@ -802,6 +984,157 @@
 
   //-- PUB SUB - END ---------------------------------------------------------------------------------------------------
 
+  //-- LIVE CONTROLLERS - START ----------------------------------------------------------------------------------------
+
+  // DOM events sent to the live controllers, `<button stx-click="increment" stx-value-id="1">`
+  const LIVE_EVENTS = ['click', 'submit', 'change', 'input'];
+
+  /**
+   * Connects the elements rendered by live controllers (`data-stx-live`) to the server
+   */
+  function mountLiveControllers() {
+    document.querySelectorAll('[data-stx-live]').forEach((element) => mountLiveController(element))
+  }
+
+  /**
+   * Keeps the render of the controller, `{s: static, 0: dynamic, 1: dynamic...}`, applying the diffs sent by the server
+   *
+   * @param element {HTMLElement}
+   */
+  function mountLiveController(element) {
+    const id = element.dataset.stxLive
+    // signed params, allow the server to rebuild the controller when the client reconnects
+    const channel = STX.channel('stx_live:' + id, {par: element.dataset.stxCtrlPar})
+    let rendered
+
+    const update = () => {
+      let template = document.createElement('template')
+      template.innerHTML = renderedToHtml(rendered).trim()
+      let target = template.content.firstElementChild
+      if (target) {
+        morph(element, target)
+      }
+    }
+
+    channel.on('render', (payload) => {
+      rendered = payload
+      update()
+    })
+
+    channel.on('diff', (payload) => {
+      if (rendered) {
+        rendered = mergeRendered(rendered, payload)
+        update()
+      }
+    })
+
+    LIVE_EVENTS.forEach((type) => {
+      element.addEventListener(type, (event) => {
+        let target = event.target.closest('[stx-' + type + ']')
+        if (!target || !element.contains(target)) {
+          return
+        }
+        if (type === 'submit') {
+          event.preventDefault()
+        }
+
+        let params = {}
+        for (let attr of target.attributes) {
+          if (attr.name.startsWith('stx-value-')) {
+            params[attr.name.substring(10)] = attr.value
+          }
+        }
+        let form = target.tagName === 'FORM' ? target : target.form
+        if (form && type !== 'click') {
+          new FormData(form).forEach((value, name) => params[name] = value)
+        }
+        if (target.name !== undefined && target.value !== undefined && type !== 'submit') {
+          params.value = target.value
+        }
+
+        channel.push('event', {event: target.getAttribute('stx-' + type), params: params})
+          .catch((reason) => console.log('live event', reason))
+      })
+    })
+  }
+
+  /**
+   * Applies a diff to the render, when the diff has the static part (`s`), it replaces the entire render
+   */
+  function mergeRendered(rendered, diff) {
+    if (diff.s) {
+      return diff
+    }
+    for (let key in diff) {
+      let value = diff[key]
+      let current = rendered[key]
+      if (typeof value === 'object' && !value.s && current && typeof current === 'object') {
+        rendered[key] = mergeRendered(current, value)
+      } else {
+        rendered[key] = value
+      }
+    }
+    return rendered
+  }
+
+  function renderedToHtml(rendered) {
+    let statics = rendered.s
+    let html = statics[0]
+    for (let i = 1; i < statics.length; i++) {
+      let dynamic = rendered[i - 1]
+      html += (dynamic && typeof dynamic === 'object') ? renderedToHtml(dynamic) : (dynamic || '')
+      html += statics[i]
+    }
+    return html
+  }
+
+  /**
+   * Updates the element to be equal to the target, changing only what is different, preserving the DOM state (focus,
+   * selection) of unchanged nodes
+   */
+  function morph(from, to) {
+    if (from.nodeType !== to.nodeType || from.nodeName !== to.nodeName) {
+      from.replaceWith(to)
+      return
+    }
+
+    if (from.nodeType !== Node.ELEMENT_NODE) {
+      if (from.nodeValue !== to.nodeValue) {
+        from.nodeValue = to.nodeValue
+      }
+      return
+    }
+
+    for (let attr of Array.from(from.attributes)) {
+      if (!to.hasAttribute(attr.name)) {
+        from.removeAttribute(attr.name)
+      }
+    }
+    for (let attr of Array.from(to.attributes)) {
+      if (from.getAttribute(attr.name) !== attr.value) {
+        from.setAttribute(attr.name, attr.value)
+      }
+    }
+    if ((from.tagName === 'INPUT' || from.tagName === 'TEXTAREA') && from !== document.activeElement) {
+      from.value = to.value
+    }
+
+    let fromChildren = Array.from(from.childNodes)
+    let toChildren = Array.from(to.childNodes)
+    toChildren.forEach((child, i) => {
+      if (i < fromChildren.length) {
+        morph(fromChildren[i], child)
+      } else {
+        from.appendChild(child)
+      }
+    })
+    for (let i = toChildren.length; i < fromChildren.length; i++) {
+      fromChildren[i].remove()
+    }
+  }
+
+  //-- LIVE CONTROLLERS - END ------------------------------------------------------------------------------------------
+
   /**
    * Starts the Syntax Client
    */
@@ -815,8 +1148,7 @@
       }
     })
 
-    let channel = STX.channel("xpto:beribecanta", {nome: 'albumina'});
-    console.log(channel)
+    mountLiveControllers()
   }
 
   if (document.readyState === 'loading') {
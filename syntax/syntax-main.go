@@ -8,6 +8,7 @@ import (
 	"github.com/syntax-framework/chain"
 	"github.com/syntax-framework/shtml"
 	"github.com/syntax-framework/shtml/cmn"
+	"github.com/syntax-framework/shtml/sht"
 	"io/fs"
 	"log"
 	"net/http"
@@ -16,6 +17,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type RouteType uint8
@@ -30,6 +33,7 @@ const (
 type FileSystem struct {
 	fs       fs.FS
 	root     string   // root dir
+	dir      string   // directory on disk, watched by the live reload. Empty on embed FileSystem
 	Ignored  []string // existing directories in that fsys starting with `_`
 	priority int      // allows prioritizing filesystems, used by libs to make components available
 	embed    bool
@@ -37,18 +41,47 @@ type FileSystem struct {
 
 type Syntax struct {
 	router      *chain.Router
+	routerMutex sync.RWMutex
+	routes      []*routeHandle  // allows rebuilding the router, see rebuildRouter
+	middlewares [][]interface{} // arguments of Use
+	serving     bool            // routes registered after Init rebuild the router
 	Config      *Config
 	Bundler     *Bundler
 	FileSystems []*FileSystem
 	Controllers []*Controller
 	//host       string
-	pages  []*PageConfig
-	models []*Model
+	controllersMutex sync.RWMutex
+	pageRoutes       map[string]*pageRoute // by file
+	pageRoutesMutex  sync.RWMutex
+	errorPages       map[int]*pageRoute // by status, nil when the application has no error page for the status
+	errorPagesMutex  sync.RWMutex
+	pubsub           PubSubAdapter
+	channels         map[string]*Channel
+	channelsMutex    sync.RWMutex
+	sseHub           *sseHub
+	sseReplay        *sseReplay
+	topicLogs        map[string]*topicLog
+	topicLogsMutex   sync.RWMutex
+	liveControllers  *liveControllers
+	controllerParams *controllerParamsCodec
+	pages            []*PageConfig
+	models           []*Model
+	modelCache       ModelCacheStore
+	modelCacheGen    modelCacheGenerations
+	modelFlight      modelFlight
+	liveReload       *liveReload
 	//middleware   []*Middleware
 	viewsBaseDir string
 	filesLookup  map[string]*FileSystem // cache lookup
+	filesMutex   sync.Mutex
+	compileMutex sync.Mutex      // the files loaded by a compilation are its dependencies, see compilePage
+	compileLoads map[string]bool // files loaded by the compilation in progress
+	pageGraph    pageGraph
+	errorGraph   pageGraph // dependencies of the error pages, see getErrorPage
 	Template     shtml.TemplateSystem
 	initialized  bool
+	initMutex    sync.RWMutex    // initialized is read by the controllers registered while Init runs
+	initSteps    map[string]bool // steps of Init already completed, see initStep
 	Handler      http.Handler
 }
 
@@ -66,20 +99,31 @@ func New(config *Config) *Syntax {
 		//site.AddFileSystemDir(path+"/web/", 0)
 	}
 
-	router := chain.New()
 	app := &Syntax{
 		//fsys:         viewsFS,
 		//viewsBaseDir: viewsBaseDir,
 		Config:  config,
 		Bundler: &Bundler{},
 		//host:   host,
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			router.ServeHTTP(w, r)
-		}),
-		router:      router,
-		filesLookup: map[string]*FileSystem{},
+		router:          chain.New(),
+		filesLookup:     map[string]*FileSystem{},
+		pubsub:          &PubSub{},
+		channels:        map[string]*Channel{},
+		topicLogs:       map[string]*topicLog{},
+		liveControllers: &liveControllers{},
+		sseReplay:       newSSEReplay(config.LiveReplaySize, time.Duration(config.LiveReplayAge)*time.Second),
 	}
 
+	if address := strings.TrimSpace(config.PubSub.Address); address != "" {
+		network := strings.TrimSpace(config.PubSub.Network)
+		if network == "" {
+			network = "tcp"
+		}
+		app.UsePubSub(NewPubSubBrokerAdapter(network, address))
+	}
+
+	app.Handler = http.HandlerFunc(app.ServeHTTP)
+
 	app.AddFileSystemEmbed(syntaxDefaultFiles, "static/", -1)
 
 	app.Template = shtml.New(func(filepath string) (string, error) {
@@ -100,36 +144,110 @@ func (s *Syntax) AddPage(p *PageConfig) *Syntax {
 	return s
 }
 
-// Init initializes the site, performs the processing of static files and initializes the routes
+// Init initializes the site, performs the processing of static files and initializes the routes. When Init fails,
+// the problem can be fixed and Init called again, the steps already completed are not executed again.
 func (s *Syntax) Init() error {
-	if s.initialized {
+	if s.isInitialized() {
 		return nil
 	}
-	s.initialized = true
 
-	s.initLiveServer()
+	if errs := s.ValidateControllers(); len(errs) > 0 {
+		return errs[0]
+	}
+
+	for _, model := range s.models {
+		if model == nil || strings.TrimSpace(model.Name) == "" || model.Load == nil {
+			name := ""
+			if model != nil {
+				name = model.Name
+			}
+			return errorModelInvalid(name)
+		}
+	}
 
-	s.registerDirectives()
+	if err := s.initStep("secret", s.initSecretKeyBase); err != nil {
+		return err
+	}
+
+	if err := s.initStep("live", s.initLiveServer); err != nil {
+		return err
+	}
+
+	if err := s.initStep("topics", s.initTopicLogs); err != nil {
+		return err
+	}
+
+	if err := s.initStep("cache", s.initModelCache); err != nil {
+		return err
+	}
+
+	_ = s.initStep("directives", func() error {
+		s.registerDirectives()
+		s.initErrorPages()
+		return nil
+	})
 
 	config := s.Config
 	if config.Dev {
 		// live reload
-		if !config.LiveReload.Disabled {
-			s.liveReloadInit(config.LiveReload)
+		err := s.initStep("livereload", func() error {
+			return s.liveReloadInit(config.LiveReload)
+		})
+		if err != nil {
+			return err
 		}
 	}
 
-	s.serveAssets()
+	_ = s.initStep("assets", func() error {
+		s.serveAssets()
+		return nil
+	})
 
-	// serve pages
+	// serve pages, the pages already routed by a failed Init are kept
 	err := s.servePages()
 	if err != nil {
 		return err
 	}
 
+	s.routerMutex.Lock()
+	s.serving = true
+	s.routerMutex.Unlock()
+
+	s.initMutex.Lock()
+	s.initialized = true
+	s.initMutex.Unlock()
+
+	if s.liveReload != nil {
+		// changed files are compiled again before reloading the browser
+		s.liveReload.changed = s.liveReloadChanged
+		go s.liveReload.watch()
+	}
+
 	return nil
 }
 
+// initStep runs a step of Init only once, the step is completed when it returns no error. A failed step must not
+// register anything (routes, channels, subscriptions), it is executed again by the next Init.
+func (s *Syntax) initStep(name string, step func() error) error {
+	if s.initSteps[name] {
+		return nil
+	}
+	if err := step(); err != nil {
+		return err
+	}
+	if s.initSteps == nil {
+		s.initSteps = map[string]bool{}
+	}
+	s.initSteps[name] = true
+	return nil
+}
+
+func (s *Syntax) isInitialized() bool {
+	s.initMutex.RLock()
+	defer s.initMutex.RUnlock()
+	return s.initialized
+}
+
 // AddFileSystemDir register a new directory FileSystem on that site
 func (s *Syntax) AddFileSystemDir(root string, priority int) {
 	dir := path.Clean(root)
@@ -137,6 +255,7 @@ func (s *Syntax) AddFileSystemDir(root string, priority int) {
 		fs:       os.DirFS(dir),
 		priority: priority,
 		root:     "",
+		dir:      dir,
 		embed:    false,
 	})
 }
@@ -162,6 +281,7 @@ func (s *Syntax) addFileSystem(system *FileSystem) {
 // registerDirectives register custom Syntax directives
 func (s *Syntax) registerDirectives() {
 	s.Template.Register(PageDirective)
+	s.Template.Register(ModelDirective)
 	s.Template.Register(s.CreateControllerDirectives()...)
 }
 
@@ -197,6 +317,14 @@ func (s *Syntax) servePages() error {
 				//	fPath = "/" + fPath
 				//}
 
+				s.pageRoutesMutex.RLock()
+				_, routed := s.pageRoutes[fPath]
+				s.pageRoutesMutex.RUnlock()
+				if routed {
+					// Init called again after a failure
+					return nil
+				}
+
 				errHtmlPage := s.processPage(fPath)
 				if errHtmlPage != nil {
 					return errHtmlPage // @TODO: Custom error
@@ -212,20 +340,86 @@ func (s *Syntax) servePages() error {
 	return nil
 }
 
+// pageRoute a page served by the application, compiled again when it changes in development
+type pageRoute struct {
+	mutex       sync.RWMutex
+	file        string
+	path        string   // route
+	params      []string // names of the route params, see pageRoutePath
+	compiled    *sht.Compiled
+	config      *PageConfig // definition at compile time
+	layout      *Layout
+	controllers map[string]bool // names of the controllers used by the page
+	models      []*Model        // models declared by the page
+	err         error           // compile error, shown in the browser in development
+}
+
 // processPage load, compile and route page
-func (s *Syntax) processPage(path string) error {
+func (s *Syntax) processPage(file string) error {
 
-	pageCompiled, compileContext, err := s.Template.Compile(path)
+	path, params, err := pageRoutePath(file)
 	if err != nil {
 		return err
 	}
+	// ex. `users/[id].html` and `users/[name].html`
+	if err = s.checkRoute(http.MethodGet, path); err != nil {
+		return err
+	}
 
-	if path[0] != '/' {
-		path = "/" + path
+	page := &pageRoute{file: file, path: path, params: params}
+	if err := s.compilePage(page); err != nil {
+		if !s.Config.Dev {
+			return err
+		}
+		// the server keeps running, the page shows the error until it is fixed
+		log.Printf("[syntax] unable to compile the page %s. %s", file, err)
 	}
 
-	if strings.HasSuffix(path, "/index.html") {
-		path = strings.TrimSuffix(path, "index.html")
+	s.pageRoutesMutex.Lock()
+	if s.pageRoutes == nil {
+		s.pageRoutes = map[string]*pageRoute{}
+	}
+	s.pageRoutes[file] = page
+	s.pageRoutesMutex.Unlock()
+
+	err = s.addRoute(http.MethodGet, path, func(ctx *chain.Context) {
+		s.renderPage(ctx, page)
+	})
+	if err != nil {
+		s.pageRoutesMutex.Lock()
+		delete(s.pageRoutes, file)
+		s.pageRoutesMutex.Unlock()
+		s.pageGraph.delete(file)
+	}
+	return err
+}
+
+// compilePage compiles the page and its layout
+func (s *Syntax) compilePage(page *pageRoute) error {
+	return s.compileTemplate(page, &s.pageGraph)
+}
+
+// compileTemplate compiles the page and its layout, the files loaded are the dependencies of the page in the graph
+func (s *Syntax) compileTemplate(page *pageRoute, graph *pageGraph) error {
+	s.compileMutex.Lock()
+	defer s.compileMutex.Unlock()
+
+	s.filesMutex.Lock()
+	s.compileLoads = map[string]bool{}
+	s.filesMutex.Unlock()
+
+	defer func() {
+		s.filesMutex.Lock()
+		loads := s.compileLoads
+		s.compileLoads = nil
+		s.filesMutex.Unlock()
+		// templates, layout and scripts used by the page
+		graph.set(page.file, loads)
+	}()
+
+	pageCompiled, compileContext, err := s.Template.Compile(page.file)
+	if err != nil {
+		return page.failed(err)
 	}
 
 	// definition of layout at compile time
@@ -233,8 +427,8 @@ func (s *Syntax) processPage(path string) error {
 	var pageConfigCompile *PageConfig
 
 	layoutName := LayoutDefault
-	if page := compileContext.Get(PageConfigKey); page != nil {
-		if pageConfig, isPageConfig := page.(*PageConfig); isPageConfig {
+	if config := compileContext.Get(PageConfigKey); config != nil {
+		if pageConfig, isPageConfig := config.(*PageConfig); isPageConfig {
 			// if we have page setup at compile time, you already do layout processing
 			if pageConfig.Layout != "" {
 				layoutName = pageConfig.Layout
@@ -243,9 +437,14 @@ func (s *Syntax) processPage(path string) error {
 		}
 	}
 
+	models, err := s.resolvePageModels(compileContext, page.file)
+	if err != nil {
+		return page.failed(err)
+	}
+
 	// load page layout, at compile time
 	if layout, err = s.getLayout(layoutName); err != nil {
-		return err
+		return page.failed(err)
 	}
 
 	// page assets
@@ -256,65 +455,153 @@ func (s *Syntax) processPage(path string) error {
 	if layout.Compiled.Assets != nil {
 		assets = append(assets, layout.Compiled.Assets...)
 	}
-	s.Bundler.SetPageAssets(path, assets)
+	s.Bundler.SetPageAssets(page.path, assets)
 
-	s.GET(path, func(ctx *chain.Context) {
-		// @TODO: LastModified, checkPreconditions
+	page.mutex.Lock()
+	page.compiled = pageCompiled
+	page.config = pageConfigCompile
+	page.layout = layout
+	page.controllers = pageControllers(compileContext)
+	page.models = models
+	page.err = nil
+	page.mutex.Unlock()
 
-		pageConfigRuntime := pageConfigCompile
+	return nil
+}
 
-		// compile page content
-		rootScope := s.Template.NewScope()
+// failed records the compile error of the page
+func (page *pageRoute) failed(err error) error {
+	page.mutex.Lock()
+	page.err = err
+	page.mutex.Unlock()
+	return err
+}
 
-		timing := rootScope.Context.Timing
+// recompileControllerPages compiles again the pages that use the controller, used when the controller is replaced in
+// development
+func (s *Syntax) recompileControllerPages(name string) {
+	s.pageRoutesMutex.RLock()
+	var pages []*pageRoute
+	for _, page := range s.pageRoutes {
+		page.mutex.RLock()
+		if page.controllers[name] {
+			pages = append(pages, page)
+		}
+		page.mutex.RUnlock()
+	}
+	s.pageRoutesMutex.RUnlock()
 
-		_metricRenderPage := timing.Metric("rpc", "<!{S}> Render Content").Start()
+	for _, page := range pages {
+		if err := s.compilePage(page); err != nil {
+			log.Printf("[syntax] unable to recompile the page %s. %s", page.file, err)
+		}
+	}
+}
 
-		pageRendered := pageCompiled.Exec(rootScope)
+// renderPage renders the page with its layout
+func (s *Syntax) renderPage(ctx *chain.Context, page *pageRoute) {
+	// @TODO: LastModified, checkPreconditions
 
-		_metricRenderPage.Stop()
+	page.mutex.RLock()
+	models := page.models
+	compileErr := page.err
+	page.mutex.RUnlock()
 
-		// get page info
-		if page := rootScope.Context.Get(PageConfigKey); page != nil {
-			if pageConfig, isPageConfig := page.(*PageConfig); isPageConfig {
-				pageConfigRuntime = pageConfig
-			}
-		}
+	if compileErr != nil {
+		s.renderCompileError(ctx.Writer, ctx.Request, compileErr, page.file)
+		return
+	}
 
-		if pageConfigRuntime == nil {
-			pageConfigRuntime = &PageConfig{}
+	// compile page content
+	rootScope := s.Template.NewScope()
+	rootScope.Context.Set(RequestContextKey, ctx)
+
+	// route params, `{params.id}`
+	params := routeParams(ctx, page.params)
+	rootScope.Context.Set(RouteParamsKey, params)
+	rootScope.Set("params", params)
+
+	if len(models) > 0 {
+		_metricModels := rootScope.Context.Timing.Metric("mdl", "<!{S}> Load Models").Start()
+		status, err := s.loadModels(models, ctx, params, rootScope)
+		_metricModels.Stop()
+		if status != 0 {
+			log.Printf("[syntax] unable to load the models of the page %s. %s", page.file, err)
+			s.renderError(ctx.Writer, ctx.Request, status, err, nil)
+			return
 		}
+	}
 
-		_metricRenderFull := timing.Metric("rpf", "<!{S}> Render Full").Start()
+	if err := s.writePage(ctx.Writer, page, rootScope, http.StatusOK); err != nil {
+		log.Printf("[syntax] unable to render the page %s. %s", page.file, err)
+		s.renderError(ctx.Writer, ctx.Request, http.StatusInternalServerError, err, nil)
+	}
+}
 
-		layoutScope := s.Template.NewScope()
-		layoutScope.Set("page", pageConfigRuntime)
-		layoutScope.Set("content", pageRendered.String())
-		layoutScope.Set("styles", s.Bundler.GetStyles(path))
-		layoutScope.Set("scripts", s.Bundler.GetScripts(path))
-		rendered := layout.Compiled.Exec(layoutScope)
+// writePage executes the page and its layout and writes the response. Nothing is written when a controller fails
+// while rendering (see controllerFailed), the error is returned.
+func (s *Syntax) writePage(w http.ResponseWriter, page *pageRoute, rootScope *sht.Scope, status int) error {
+	page.mutex.RLock()
+	pageCompiled := page.compiled
+	pageConfigRuntime := page.config
+	layout := page.layout
+	page.mutex.RUnlock()
 
-		_metricRenderFull.Stop()
+	timing := rootScope.Context.Timing
 
-		contentString := rendered.String()
-		content := []byte(contentString)
+	_metricRenderPage := timing.Metric("rpc", "<!{S}> Render Content").Start()
 
-		header := ctx.Header()
-		header.Set("GetContent-Restrict", "text/html; charset=utf-8")
-		header.Set("Content-Length", strconv.Itoa(len(content)))
+	pageRendered := pageCompiled.Exec(rootScope)
 
-		// Server metrics
-		if s.Config.Dev {
-			header.Set("Server-Timing", rootScope.Context.Timing.String())
-		}
+	_metricRenderPage.Stop()
 
-		ctx.WriteHeader(200)
+	if err := controllerError(rootScope.Context); err != nil {
+		return err
+	}
 
-		if _, errWrite := ctx.Write(content); errWrite != nil {
-			log.Println(errWrite)
+	// get page info
+	if config := rootScope.Context.Get(PageConfigKey); config != nil {
+		if pageConfig, isPageConfig := config.(*PageConfig); isPageConfig {
+			pageConfigRuntime = pageConfig
 		}
-	})
+	}
+
+	if pageConfigRuntime == nil {
+		pageConfigRuntime = &PageConfig{}
+	}
+
+	_metricRenderFull := timing.Metric("rpf", "<!{S}> Render Full").Start()
+
+	layoutScope := s.Template.NewScope()
+	layoutScope.Set("page", pageConfigRuntime)
+	layoutScope.Set("content", pageRendered.String())
+	layoutScope.Set("styles", s.Bundler.GetStyles(page.path))
+	layoutScope.Set("scripts", s.Bundler.GetScripts(page.path))
+	rendered := layout.Compiled.Exec(layoutScope)
+
+	_metricRenderFull.Stop()
 
+	if err := controllerError(layoutScope.Context); err != nil {
+		return err
+	}
+
+	contentString := rendered.String()
+	content := []byte(contentString)
+
+	header := w.Header()
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Content-Length", strconv.Itoa(len(content)))
+
+	// Server metrics
+	if s.Config.Dev {
+		header.Set("Server-Timing", rootScope.Context.Timing.String())
+	}
+
+	w.WriteHeader(status)
+
+	if _, errWrite := w.Write(content); errWrite != nil {
+		log.Println(errWrite)
+	}
 	return nil
 }
 
@@ -339,12 +626,12 @@ func (s *Syntax) serveAssets() {
 				asset = nil
 			}
 		} else {
-			http.Error(w, "501 not implemented", http.StatusNotImplemented)
+			s.renderError(w, ctx.Request, http.StatusNotImplemented, nil, nil)
 			return
 		}
 
 		if asset == nil {
-			http.Error(w, "404 page not found", http.StatusNotFound)
+			s.renderError(w, ctx.Request, http.StatusNotFound, nil, nil)
 			return
 		}
 
@@ -413,13 +700,20 @@ func (s *Syntax) loadFile(filepath string) (string, error) {
 	var fileSystem *FileSystem
 	var err error
 
+	s.filesMutex.Lock()
+	if s.compileLoads != nil {
+		s.compileLoads[filepath] = true
+	}
+	system, found := s.filesLookup[filepath]
+	s.filesMutex.Unlock()
+
 	// lookup
-	if system, found := s.filesLookup[filepath]; found {
-		file, err = system.fs.Open(system.root + filepath)
+	if found {
+		file, err = system.fs.Open(strings.TrimPrefix(path.Join(system.root, filepath), "/"))
 		if err != nil {
-			if pathError, isPathError := err.(*fs.PathError); isPathError && pathError.Err == fs.ErrNotExist {
+			if errors.Is(err, fs.ErrNotExist) {
 				// file removed from this file system
-				delete(s.filesLookup, filepath)
+				s.forgetFile(filepath)
 			} else {
 				return "", err
 			}
@@ -453,7 +747,9 @@ func (s *Syntax) loadFile(filepath string) (string, error) {
 		return "", fs.ErrNotExist
 	}
 
+	s.filesMutex.Lock()
 	s.filesLookup[filepath] = fileSystem
+	s.filesMutex.Unlock()
 
 	// load content
 	defer file.Close()
@@ -465,15 +761,6 @@ func (s *Syntax) loadFile(filepath string) (string, error) {
 	return buf.String(), nil
 }
 
-// ServeHTTP implements http.Handler
-//func (s *Syntax) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-//  abspath := request.URL.Path
-//  relpath := path.Clean(strings.TrimPrefix(abspath, "/"))
-//  fmt.Println(abspath)
-//  fmt.Println(relpath)
-//  panic(relpath)
-//}
-
 //func (site *Syntax) openPage(file string) (*Model, error) {
 //
 //}
@@ -0,0 +1,407 @@
+package syntax
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/syntax-framework/shtml/cmn"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var errorTopicPersistExists = cmn.Err(
+	"pubsub.topic.persist.exists",
+	"The topic is already persistent.", "Topic: %s",
+)
+
+// TopicRetention how long the messages of a persistent topic are kept. When both limits are zero, all messages are
+// kept.
+type TopicRetention struct {
+	MaxAge  time.Duration // messages older than that are discarded
+	MaxSize int64         // max size of the log file, in bytes. The oldest messages are discarded first.
+}
+
+// topicLogRecord a line of the log file
+type topicLogRecord struct {
+	ID      int    `json:"id"`
+	Time    int64  `json:"time"` // unix nano
+	Event   string `json:"event,omitempty"`
+	Data    string `json:"data,omitempty"`
+	Evicted bool   `json:"evicted,omitempty"` // first line after compaction, holds the id of the last discarded message
+}
+
+// topicLogEntry index of a record in the log file
+type topicLogEntry struct {
+	id     int
+	time   int64
+	offset int64
+	length int64
+}
+
+// topicLog append-only log of the messages of a persistent topic, allows replaying the messages even after a server
+// restart
+type topicLog struct {
+	mutex          sync.Mutex
+	path           string
+	retention      TopicRetention
+	file           *os.File
+	size           int64
+	lastID         int
+	evictedID      int
+	index          []topicLogEntry
+	lastCompaction time.Time
+	unsubscribe    func() // subscription of the topic, nil until the application is initialized
+}
+
+// openTopicLog opens (or creates) the log file and loads its index
+func openTopicLog(path string, retention TopicRetention) (*topicLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &topicLog{
+		path:      path,
+		retention: retention,
+		file:      file,
+	}
+
+	if err = l.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	l.compact(time.Now())
+
+	return l, nil
+}
+
+// load reads the index of the log file. An incomplete last line (crash while writing) is discarded.
+func (l *topicLog) load() error {
+	if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(l.file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				// incomplete record
+				if errTruncate := l.file.Truncate(offset); errTruncate != nil {
+					return errTruncate
+				}
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		record := &topicLogRecord{}
+		if errJson := json.Unmarshal(line, record); errJson != nil {
+			return errJson
+		}
+
+		length := int64(len(line))
+		if record.Evicted {
+			l.evictedID = record.ID
+		} else {
+			l.index = append(l.index, topicLogEntry{id: record.ID, time: record.Time, offset: offset, length: length})
+		}
+		if record.ID > l.lastID {
+			l.lastID = record.ID
+		}
+		offset += length
+	}
+	l.size = offset
+	return nil
+}
+
+// append writes the event in the log, assigning its id
+func (l *topicLog) append(event *SSEEvent) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	id := nextEventID(event.timestamp, l.lastID)
+	line, err := json.Marshal(&topicLogRecord{
+		ID:    id,
+		Time:  event.timestamp.UnixNano(),
+		Event: string(event.Event),
+		Data:  string(event.Data),
+	})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if _, err = l.file.Write(line); err != nil {
+		return err
+	}
+
+	l.index = append(l.index, topicLogEntry{id: id, time: event.timestamp.UnixNano(), offset: l.size, length: int64(len(line))})
+	l.size += int64(len(line))
+	l.lastID = id
+	event.ID = []byte(strconv.Itoa(id))
+
+	l.compact(event.timestamp)
+
+	return nil
+}
+
+// since returns, in order, all events after the given id. Returns false when events after that id have already been
+// discarded by the retention policy.
+func (l *topicLog) since(id int) ([]*SSEEvent, bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.evictedID > id {
+		return nil, false, nil
+	}
+
+	var events []*SSEEvent
+	for _, entry := range l.index {
+		if entry.id <= id {
+			continue
+		}
+
+		line := make([]byte, entry.length)
+		if _, err := l.file.ReadAt(line, entry.offset); err != nil {
+			return nil, false, err
+		}
+		record := &topicLogRecord{}
+		if err := json.Unmarshal(line, record); err != nil {
+			return nil, false, err
+		}
+		events = append(events, &SSEEvent{
+			timestamp: time.Unix(0, record.Time),
+			ID:        []byte(strconv.Itoa(record.ID)),
+			Event:     []byte(record.Event),
+			Data:      []byte(record.Data),
+		})
+	}
+	return events, true, nil
+}
+
+// compact applies the retention policy, rewriting the file without the discarded records.
+//
+// By size, the log is reduced to 3/4 of MaxSize, so that the file is not rewritten on every new message. By age, the
+// check is done at most once per minute.
+func (l *topicLog) compact(now time.Time) {
+	discard := 0
+
+	if l.retention.MaxAge > 0 && now.Sub(l.lastCompaction) >= time.Minute {
+		l.lastCompaction = now
+		limit := now.Add(-l.retention.MaxAge).UnixNano()
+		for discard < len(l.index) && l.index[discard].time < limit {
+			discard++
+		}
+	}
+
+	if l.retention.MaxSize > 0 && l.size > l.retention.MaxSize {
+		size := l.size
+		target := l.retention.MaxSize * 3 / 4
+		for i := 0; i < len(l.index) && size > target; i++ {
+			size -= l.index[i].length
+			if i >= discard {
+				discard = i + 1
+			}
+		}
+	}
+
+	if discard == 0 {
+		return
+	}
+
+	if err := l.rewrite(discard); err != nil {
+		log.Printf("[syntax] unable to compact the log %s. %s", l.path, err)
+	}
+}
+
+// rewrite creates a new log file without the first records and replaces the current file
+func (l *topicLog) rewrite(discard int) error {
+	evictedID := l.index[discard-1].id
+	kept := l.index[discard:]
+
+	tmpPath := l.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	header, _ := json.Marshal(&topicLogRecord{ID: evictedID, Evicted: true})
+	header = append(header, '\n')
+	writer := bufio.NewWriter(tmp)
+	writer.Write(header)
+
+	offset := int64(len(header))
+	index := make([]topicLogEntry, 0, len(kept))
+	for _, entry := range kept {
+		line := make([]byte, entry.length)
+		if _, err = l.file.ReadAt(line, entry.offset); err != nil {
+			tmp.Close()
+			return err
+		}
+		writer.Write(line)
+		index = append(index, topicLogEntry{id: entry.id, time: entry.time, offset: offset, length: entry.length})
+		offset += entry.length
+	}
+
+	if err = writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, l.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(l.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	l.file.Close()
+	l.file = file
+	l.index = index
+	l.size = offset
+	l.evictedID = evictedID
+	return nil
+}
+
+func (l *topicLog) close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file.Close()
+}
+
+// PersistTopic makes a topic, in the format `channel:topic`, persistent. Its messages are written in an append-only
+// log in the `Config.PersistDir` directory and can be replayed to the clients even after a server restart.
+//
+// Each instance of the application keeps its own log, so the topic is always subscribed, even when there are no
+// connected clients. The topic is subscribed on Init, in the PubSub defined by then (see Syntax.UsePubSub).
+func (s *Syntax) PersistTopic(topic string, retention TopicRetention) error {
+	channelName, topicName, err := parseTopic(topic)
+	if err != nil {
+		return err
+	}
+
+	s.topicLogsMutex.Lock()
+	if _, exists := s.topicLogs[topic]; exists {
+		s.topicLogsMutex.Unlock()
+		return errorTopicPersistExists(topic)
+	}
+
+	dir := s.Config.PersistDir
+	if dir == "" {
+		dir = "data/topics"
+	}
+
+	persisted, err := openTopicLog(filepath.Join(dir, channelName, topicName+".log"), retention)
+	if err != nil {
+		s.topicLogsMutex.Unlock()
+		return err
+	}
+	if s.topicLogs == nil {
+		s.topicLogs = map[string]*topicLog{}
+	}
+	s.topicLogs[topic] = persisted
+	s.topicLogsMutex.Unlock()
+
+	if !s.isInitialized() {
+		return nil
+	}
+	if err = s.subscribeTopicLog(topic); err != nil {
+		s.topicLogsMutex.Lock()
+		delete(s.topicLogs, topic)
+		s.topicLogsMutex.Unlock()
+		persisted.close()
+		return err
+	}
+	return nil
+}
+
+// initTopicLogs subscribes the persistent topics declared before Init
+func (s *Syntax) initTopicLogs() error {
+	s.topicLogsMutex.RLock()
+	var topics []string
+	for topic := range s.topicLogs {
+		topics = append(topics, topic)
+	}
+	s.topicLogsMutex.RUnlock()
+
+	for _, topic := range topics {
+		if err := s.subscribeTopicLog(topic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribeTopicLog subscribes the persistent topic, each message is written in the log and then delivered to the
+// sockets of the topic. The sockets that joined the topic before are now served by this subscription (see
+// Channel.persist).
+func (s *Syntax) subscribeTopicLog(topic string) error {
+	channelName, topicName, err := parseTopic(topic)
+	if err != nil {
+		return err
+	}
+
+	s.topicLogsMutex.Lock()
+	persisted := s.topicLogs[topic]
+	if persisted == nil || persisted.unsubscribe != nil {
+		s.topicLogsMutex.Unlock()
+		return nil
+	}
+	unsubscribe, err := s.pubsub.Subscribe(topic, func(content interface{}) {
+		event, errEncode := encodeTopicEvent(channelName, topicName, content)
+		if errEncode != nil {
+			log.Printf("[syntax] unable to serialize message to topic %s. %s", topic, errEncode)
+			return
+		}
+		if errAppend := persisted.append(event); errAppend != nil {
+			log.Printf("[syntax] unable to persist message to topic %s. %s", topic, errAppend)
+		}
+		s.sseReplay.record(topic, event)
+
+		if channel, errChannel := s.getChannel(channelName); errChannel == nil {
+			channel.broadcast(topicName, event)
+		}
+	})
+	if err != nil {
+		s.topicLogsMutex.Unlock()
+		return err
+	}
+	persisted.unsubscribe = unsubscribe
+	s.topicLogsMutex.Unlock()
+
+	if channel, errChannel := s.getChannel(channelName); errChannel == nil {
+		channel.persist(topicName)
+	}
+	return nil
+}
+
+// isTopicPersisted checks if the messages of the topic are delivered by the subscription of its log
+func (s *Syntax) isTopicPersisted(topic string) bool {
+	s.topicLogsMutex.RLock()
+	defer s.topicLogsMutex.RUnlock()
+	persisted := s.topicLogs[topic]
+	return persisted != nil && persisted.unsubscribe != nil
+}
+
+// getTopicLog obtains the log of a persistent topic, nil if the topic is not persistent
+func (s *Syntax) getTopicLog(topic string) *topicLog {
+	s.topicLogsMutex.RLock()
+	defer s.topicLogsMutex.RUnlock()
+	return s.topicLogs[topic]
+}
@@ -0,0 +1,125 @@
+package syntax
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Topic_Log_Restart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "room", "lobby.log")
+
+	log, err := openTopicLog(path, TopicRetention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for i := 0; i < 3; i++ {
+		event := &SSEEvent{timestamp: time.Now(), Event: []byte("room:lobby"), Data: []byte(strconv.Itoa(i))}
+		if err = log.append(event); err != nil {
+			t.Fatal(err)
+		}
+		id, _ := strconv.Atoi(string(event.ID))
+		ids = append(ids, id)
+	}
+	log.close()
+
+	// restart
+	log, err = openTopicLog(path, TopicRetention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.close()
+
+	events, ok, err := log.since(ids[0])
+	if err != nil || !ok {
+		t.Fatalf("topicLog.since(id) | must replay after restart\n   actual: %v %v", ok, err)
+	}
+	if len(events) != 2 || string(events[0].Data) != "1" || string(events[1].Data) != "2" {
+		t.Fatalf("topicLog.since(id) | invalid output\n   actual: %+v", events)
+	}
+
+	event := &SSEEvent{timestamp: time.Now(), Data: []byte("3")}
+	if err = log.append(event); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := strconv.Atoi(string(event.ID)); id <= ids[2] {
+		t.Errorf("topicLog.append(event) | ids must increase after restart\n   actual: %d\n expected: > %d", id, ids[2])
+	}
+
+	// retention by size discards the oldest messages
+	log.retention.MaxSize = 1
+	log.compact(time.Now())
+	if _, ok, _ = log.since(ids[0]); ok {
+		t.Errorf("topicLog.since(id) | must report discarded messages")
+	}
+}
+
+func Test_Persist_Topic_Channel(t *testing.T) {
+	s := &Syntax{
+		Config:    &Config{PersistDir: t.TempDir()},
+		pubsub:    &PubSub{},
+		channels:  map[string]*Channel{},
+		sseReplay: newSSEReplay(0, 0),
+	}
+	channel, _ := s.Channel("room")
+	channel.OnJoin("*", func(topic string, params map[string]interface{}, socket *Socket) error {
+		return nil
+	})
+
+	if err := s.PersistTopic("room:lobby", TopicRetention{}); err != nil {
+		t.Fatal(err)
+	}
+	// defined after PersistTopic, before Init
+	pubsub := &PubSub{}
+	s.UsePubSub(pubsub)
+
+	// joined before the topic is subscribed
+	first := &testSocketConn{events: make(chan *SSEEvent, 10)}
+	if err := channel.requestJoin("lobby", nil, &Socket{Channel: channel, conn: first}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.initTopicLogs(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, payload := range []string{"hello", "world"} {
+		if err := s.Broadcast("room:lobby", "message", payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var ids []int
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-first.events:
+			id, _ := strconv.Atoi(string(event.ID))
+			ids = append(ids, id)
+		case <-time.After(time.Second):
+			t.Fatalf("Syntax.PersistTopic(topic) | the message must be delivered by the PubSub defined before Init")
+		}
+	}
+	select {
+	case event := <-first.events:
+		t.Errorf("Syntax.PersistTopic(topic) | the message must be delivered once\n   actual: %s", event.Data)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if ids[0] == 0 || ids[1] <= ids[0] {
+		t.Fatalf("topicLog.append(event) | invalid ids\n   actual: %v", ids)
+	}
+
+	// reconnection, replayed from the log
+	second := &testSocketConn{events: make(chan *SSEEvent, 10), last: ids[0]}
+	if err := channel.requestJoin("lobby", nil, &Socket{Channel: channel, conn: second}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-second.events:
+		if id, _ := strconv.Atoi(string(event.ID)); id != ids[1] || !strings.Contains(string(event.Data), "world") {
+			t.Errorf("Channel.replay(topic) | invalid event\n   actual: %s %s", event.ID, event.Data)
+		}
+	default:
+		t.Errorf("Channel.replay(topic) | the persisted message must be replayed")
+	}
+}